@@ -20,6 +20,8 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var dryRunOptions = &migrationOptions{}
+
 // versionCmd represents the version command
 var dryRunCmd = &cobra.Command{
 	Use:     "dry-run",
@@ -31,10 +33,11 @@ var dryRunCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(dryRunCmd)
+	addMigrationFlags(dryRunCmd, dryRunOptions)
 }
 
 func dryRun(_ *cobra.Command, _ []string) {
-	ctx := migrationConfig.Context
-	migrator := migrate.NewMigrator(ctx, migrationConfig.KubeConfig, migrationConfig.ManagedNamespace)
-	migrator.Migrate(ctx, migrate.DryRun)
+	migrator := newMigrator(migrationConfig.Context, dryRunOptions)
+	runCtx := newRunContext(migrator)
+	migrator.Migrate(runCtx, migrate.DryRun)
 }
@@ -0,0 +1,140 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"github.com/SvcManager/svcat-operator-migrator/migrate"
+	"github.com/spf13/cobra"
+)
+
+// migrationOptions holds the flags shared by the run and dry-run commands
+type migrationOptions struct {
+	waitForStable time.Duration
+	skipUnstable  bool
+	nameTemplate  string
+
+	failOnSecretTransforms bool
+	failOnParameterDrift   bool
+	recreateMissingSecrets bool
+	credentialsPolicy      string
+
+	scaleDownSvcatController  bool
+	svcatControllerDeployment string
+	freezeNamespaces          bool
+}
+
+func addMigrationFlags(cmd *cobra.Command, options *migrationOptions) {
+	cmd.Flags().DurationVar(&options.waitForStable, "wait-for-stable", 0, "wait up to the given duration for resources with operations in progress to become stable (e.g. 10m)")
+	cmd.Flags().BoolVar(&options.skipUnstable, "skip-unstable", false, "skip resources that are not stable, and the bindings of skipped instances, instead of failing")
+	cmd.Flags().BoolVar(&options.failOnSecretTransforms, "fail-on-secret-transforms", false, "fail if bindings have secret transforms, which cannot be expressed in operator bindings")
+	cmd.Flags().BoolVar(&options.failOnParameterDrift, "fail-on-parameter-drift", false, "fail if instance parameters in SM differ from the svcat parameters and parametersFrom secrets")
+	cmd.Flags().StringVar(&options.credentialsPolicy, "credentials-policy", string(migrate.CredentialsPolicySecret), "which side wins when a binding secret differs from the binding credentials in SM: secret (upload the secret), sm (rewrite the secret from SM) or fail")
+	cmd.Flags().StringVar(&options.nameTemplate, "name-template", "", "go template for renaming resources that collide with existing operator resources or secrets, fields: .Name .Namespace .Kind (e.g. '{{.Name}}-migrated')")
+}
+
+// addSvcatControllerFlags adds the flags of the commands that modify svcat resources
+func addSvcatControllerFlags(cmd *cobra.Command, options *migrationOptions) {
+	cmd.Flags().BoolVar(&options.scaleDownSvcatController, "scale-down-svcat-controller", false, "scale the svcat controller-manager to zero while migrating and restore it afterwards")
+	cmd.Flags().StringVar(&options.svcatControllerDeployment, "svcat-controller-deployment", "", "namespace/name of the svcat controller-manager deployment (detected if not set)")
+}
+
+// addSecretFlags adds the flags controlling how binding secrets are migrated
+func addSecretFlags(cmd *cobra.Command, options *migrationOptions) {
+	cmd.Flags().BoolVar(&options.recreateMissingSecrets, "recreate-missing-secrets", false, "recreate missing binding secrets from the binding credentials in SM")
+}
+
+// addFreezeFlags adds the flags controlling the freeze of svcat resources during migration
+func addFreezeFlags(cmd *cobra.Command, options *migrationOptions) {
+	cmd.Flags().BoolVar(&options.freezeNamespaces, "freeze-namespaces", false, "reject svcat resources creation and update in the migrated namespaces while migrating")
+}
+
+// newMigrator returns a migrator for the command. The SM clients keep using ctx, so it should not be the run context,
+// which is cancelled before the step in progress completes.
+func newMigrator(ctx context.Context, options *migrationOptions) *migrate.Migrator {
+	var nameTemplate *template.Template
+	if options.nameTemplate != "" {
+		var err error
+		nameTemplate, err = template.New("name").Parse(options.nameTemplate)
+		cobra.CheckErr(err)
+	}
+	credentialsPolicy, err := migrate.ParseCredentialsPolicy(options.credentialsPolicy)
+	cobra.CheckErr(err)
+
+	smClientOptions := migrate.SMClientOptions{
+		MaxAttempts: migrationConfig.SMMaxAttempts,
+		RateLimit:   migrationConfig.SMRateLimit,
+	}
+	if migrationConfig.SMCABundle != "" {
+		smClientOptions.CABundle, err = ioutil.ReadFile(migrationConfig.SMCABundle)
+		cobra.CheckErr(err)
+	}
+	smClientOptions.Credentials, err = getSMCredentials()
+	cobra.CheckErr(err)
+
+	k8sClientOptions := migrate.K8sClientOptions{
+		QPS:     migrationConfig.K8sQPS,
+		Burst:   migrationConfig.K8sBurst,
+		Timeout: migrationConfig.K8sRequestTimeout,
+	}
+
+	migrator := migrate.NewMigrator(ctx, migrationConfig.KubeConfig, migrationConfig.ManagedNamespace, k8sClientOptions, smClientOptions)
+	migrator.WaitForStable = options.waitForStable
+	migrator.SkipUnstable = options.skipUnstable
+	migrator.NameTemplate = nameTemplate
+	migrator.FailOnSecretTransforms = options.failOnSecretTransforms
+	migrator.FailOnParameterDrift = options.failOnParameterDrift
+	migrator.RecreateMissingSecrets = options.recreateMissingSecrets
+	migrator.CredentialsPolicy = credentialsPolicy
+	migrator.ScaleDownSvcatController = options.scaleDownSvcatController
+	migrator.SvcatControllerDeployment = options.svcatControllerDeployment
+	migrator.FreezeNamespaces = options.freezeNamespaces
+	migrator.CatalogCacheDir = filepath.Join(filepath.Dir(cfgFile), "cache")
+	migrator.CatalogCacheTTL = migrationConfig.SMCatalogCacheTTL
+	return migrator
+}
+
+// getSMCredentials returns the SM credentials replacing the operator secret, from the credentials file or else from the
+// config file and environment, nil if none are configured
+func getSMCredentials() (map[string][]byte, error) {
+	credentials := migrationConfig.SMCredentials
+	if migrationConfig.SMCredentialsFile != "" {
+		content, err := ioutil.ReadFile(migrationConfig.SMCredentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		credentials = make(map[string]string)
+		if err := json.Unmarshal(content, &credentials); err != nil {
+			return nil, fmt.Errorf("failed to parse SM credentials file '%s': %v", migrationConfig.SMCredentialsFile, err.Error())
+		}
+	}
+	if credentials == nil {
+		return nil, nil
+	}
+
+	data := make(map[string][]byte, len(credentials))
+	for key, value := range credentials {
+		data[key] = []byte(value)
+	}
+	return data, nil
+}
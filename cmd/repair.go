@@ -0,0 +1,43 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var repairOptions = &migrationOptions{}
+
+// repairCmd represents the repair command
+var repairCmd = &cobra.Command{
+	Use:   "repair",
+	Short: "Repair half migrated resources",
+	Long: `Detect resources left in between states by an interrupted migration and complete their migration:
+svcat resources whose finalizers were removed but were not deleted, binding secrets without an owner
+and resources labeled in SM without an operator resource`,
+	Run: repair,
+}
+
+func init() {
+	rootCmd.AddCommand(repairCmd)
+	addSvcatControllerFlags(repairCmd, repairOptions)
+}
+
+func repair(_ *cobra.Command, _ []string) {
+	migrator := newMigrator(migrationConfig.Context, repairOptions)
+	runCtx := newRunContext(migrator)
+	migrator.Repair(runCtx)
+}
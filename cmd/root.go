@@ -17,18 +17,33 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	config "github.com/SvcManager/svcat-operator-migrator/configuartion"
+	"github.com/SvcManager/svcat-operator-migrator/migrate"
+	"github.com/SvcManager/svcat-operator-migrator/redact"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 
 	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
+const (
+	defaultK8sQPS            = 50
+	defaultK8sBurst          = 100
+	defaultK8sRequestTimeout = time.Minute
+)
+
 var (
 	cfgFile, kubeconfig, managedNamespace string
 	migrationConfig                       *config.Configuration
+
+	// runDeadline applies to the current run only, so unlike the other flags it is not read through the config
+	runDeadline time.Duration
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -44,7 +59,7 @@ var rootCmd = &cobra.Command{
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	cobra.CheckErr(rootCmd.Execute())
+	cobra.CheckErr(redact.Error(rootCmd.Execute()))
 }
 
 func init() {
@@ -52,9 +67,28 @@ func init() {
 	// Here you will define your flags and configuration MigrationConfig.
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
+	rootCmd.SetOut(redact.Writer(os.Stdout))
+	rootCmd.SetErr(redact.Writer(os.Stderr))
 	rootCmd.PersistentFlags().StringVarP(&managedNamespace, "namespace", "n", "", "namespace to find operator secret (default sap-btp-operator)")
 	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "", "config file (default is $HOME/.migrate/config.json)")
 	rootCmd.PersistentFlags().StringVarP(&kubeconfig, "kubeconfig", "k", "", "absolute path to the kubeconfig file (default $HOME/.kube/config)")
+	rootCmd.PersistentFlags().String("sm-ca-bundle", "", "path to a PEM bundle of CAs to trust when connecting to SM, in addition to the system CAs")
+	cobra.CheckErr(viper.BindPFlag("smCABundle", rootCmd.PersistentFlags().Lookup("sm-ca-bundle")))
+	rootCmd.PersistentFlags().String("sm-credentials-file", "", "path to a JSON file with SM credentials keyed as in the operator secret, used instead of the operator secret (also configurable with SM_URL, SM_TOKEN_URL, SM_CLIENT_ID, SM_CLIENT_SECRET, SM_TLS_CRT and SM_TLS_KEY)")
+	cobra.CheckErr(viper.BindPFlag("smCredentialsFile", rootCmd.PersistentFlags().Lookup("sm-credentials-file")))
+	rootCmd.PersistentFlags().Int("sm-max-attempts", migrate.DefaultSMMaxAttempts, "number of attempts of idempotent SM requests failing with a transient error, 1 disables retries")
+	cobra.CheckErr(viper.BindPFlag("smMaxAttempts", rootCmd.PersistentFlags().Lookup("sm-max-attempts")))
+	rootCmd.PersistentFlags().Float64("sm-rate-limit", 0, "maximum number of SM requests per second, 0 for no limit")
+	cobra.CheckErr(viper.BindPFlag("smRateLimit", rootCmd.PersistentFlags().Lookup("sm-rate-limit")))
+	rootCmd.PersistentFlags().Duration("sm-catalog-cache-ttl", time.Hour, "how long plans and offerings loaded from SM are cached next to the config file and reused by later runs, 0 disables the cache")
+	cobra.CheckErr(viper.BindPFlag("smCatalogCacheTTL", rootCmd.PersistentFlags().Lookup("sm-catalog-cache-ttl")))
+	rootCmd.PersistentFlags().Float32("k8s-qps", defaultK8sQPS, "maximum number of API server requests per second")
+	cobra.CheckErr(viper.BindPFlag("k8sQPS", rootCmd.PersistentFlags().Lookup("k8s-qps")))
+	rootCmd.PersistentFlags().Int("k8s-burst", defaultK8sBurst, "maximum burst of API server requests")
+	cobra.CheckErr(viper.BindPFlag("k8sBurst", rootCmd.PersistentFlags().Lookup("k8s-burst")))
+	rootCmd.PersistentFlags().Duration("k8s-request-timeout", defaultK8sRequestTimeout, "timeout of a single API server request, 0 for no timeout")
+	cobra.CheckErr(viper.BindPFlag("k8sRequestTimeout", rootCmd.PersistentFlags().Lookup("k8s-request-timeout")))
+	rootCmd.PersistentFlags().DurationVar(&runDeadline, "deadline", 0, "maximum duration of the run, when it passes the resource in progress is completed and the run stops (e.g. 2h), 0 for no deadline")
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -83,6 +117,29 @@ func initConfig() {
 	migrationConfig = config.NewConfiguration(context.Background(), viper.GetViper())
 }
 
+// newRunContext returns the context of the migrator run, which is done when the deadline passes or on SIGINT or SIGTERM.
+// A second signal runs the cleanups of the migrator, restoring its cluster changes, and exits immediately.
+// It is called once the migrator is built, until then a signal exits as usual.
+func newRunContext(migrator *migrate.Migrator) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	if runDeadline > 0 {
+		ctx, cancel = context.WithTimeout(ctx, runDeadline)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		fmt.Fprintln(rootCmd.OutOrStdout(), "*** Interrupted, stopping after the step in progress, interrupt again to exit immediately")
+		cancel()
+		<-signals
+		fmt.Fprintln(rootCmd.OutOrStdout(), "*** Interrupted again, restoring cluster changes and exiting")
+		migrator.RunCleanups()
+		os.Exit(1)
+	}()
+	return ctx
+}
+
 func createOrOverrideConfig() {
 	err := ensureDirExists(cfgFile)
 	cobra.CheckErr(err)
@@ -97,7 +154,14 @@ func createOrOverrideConfig() {
 	viper.Set("kubeconfig", kube)
 	viper.Set("managedNamespace", ns)
 
-	cobra.CheckErr(viper.WriteConfig())
+	// only the kubeconfig and namespace are persisted, the other flags apply to the current run only and writing
+	// the global viper would save them too
+	fileConfig := viper.New()
+	fileConfig.SetConfigFile(cfgFile)
+	_ = fileConfig.ReadInConfig()
+	fileConfig.Set("kubeconfig", kube)
+	fileConfig.Set("managedNamespace", ns)
+	cobra.CheckErr(fileConfig.WriteConfig())
 }
 
 func homeDir() string {
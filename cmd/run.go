@@ -21,7 +21,10 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var skipValidation *bool
+var (
+	skipValidation *bool
+	runOptions     = &migrationOptions{}
+)
 
 // runCmd represents the run command
 var runCmd = &cobra.Command{
@@ -35,14 +38,18 @@ var runCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(runCmd)
 	skipValidation = runCmd.Flags().BoolP("skip-validation", "s", false, "skip resources validation")
+	addMigrationFlags(runCmd, runOptions)
+	addSvcatControllerFlags(runCmd, runOptions)
+	addSecretFlags(runCmd, runOptions)
+	addFreezeFlags(runCmd, runOptions)
 }
 
 func run(_ *cobra.Command, _ []string) {
-	ctx := migrationConfig.Context
-	migrator := migrate.NewMigrator(ctx, migrationConfig.KubeConfig, migrationConfig.ManagedNamespace)
+	migrator := newMigrator(migrationConfig.Context, runOptions)
+	runCtx := newRunContext(migrator)
 	execMode := migrate.Run
 	if *skipValidation {
 		execMode = migrate.RunWithoutValidation
 	}
-	migrator.Migrate(ctx, execMode)
+	migrator.Migrate(runCtx, execMode)
 }
@@ -2,6 +2,8 @@ package configuartion
 
 import (
 	"context"
+	"time"
+
 	"github.com/spf13/viper"
 )
 
@@ -10,13 +12,64 @@ type Configuration struct {
 	Context          context.Context
 	ManagedNamespace string
 	KubeConfig       string
+	// SMCABundle is the path of a PEM bundle of CAs to trust when connecting to SM
+	SMCABundle string
+	// SMCredentialsFile is the path of a JSON file with SM credentials, in the format of the operator secret
+	SMCredentialsFile string
+	// SMCredentials are SM credentials from the config file or environment, keyed as in the operator secret
+	SMCredentials map[string]string
+	// SMMaxAttempts is the number of attempts of idempotent SM requests failing with a transient error
+	SMMaxAttempts int
+	// SMRateLimit is the maximum number of SM requests per second, 0 for no limit
+	SMRateLimit float64
+	// SMCatalogCacheTTL is how long plans and offerings loaded from SM are cached on disk, 0 disables the cache
+	SMCatalogCacheTTL time.Duration
+	// K8sQPS and K8sBurst limit the rate of API server requests
+	K8sQPS   float32
+	K8sBurst int
+	// K8sRequestTimeout is the timeout of a single API server request
+	K8sRequestTimeout time.Duration
+}
+
+// smCredentialKeys maps the keys of the operator secret to the config file keys and environment variables overriding them
+var smCredentialKeys = map[string]struct{ configKey, envVar string }{
+	"url":          {"sm.url", "SM_URL"},
+	"tokenurl":     {"sm.tokenurl", "SM_TOKEN_URL"},
+	"clientid":     {"sm.clientid", "SM_CLIENT_ID"},
+	"clientsecret": {"sm.clientsecret", "SM_CLIENT_SECRET"},
+	"tls.crt":      {"sm.tlscrt", "SM_TLS_CRT"},
+	"tls.key":      {"sm.tlskey", "SM_TLS_KEY"},
 }
 
 func NewConfiguration(ctx context.Context, env *viper.Viper) *Configuration {
 
 	return &Configuration{
-		Context:          ctx,
-		ManagedNamespace: env.Get("managedNamespace").(string),
-		KubeConfig:       env.Get("kubeconfig").(string),
+		Context:           ctx,
+		ManagedNamespace:  env.Get("managedNamespace").(string),
+		KubeConfig:        env.Get("kubeconfig").(string),
+		SMCABundle:        env.GetString("smCABundle"),
+		SMCredentialsFile: env.GetString("smCredentialsFile"),
+		SMCredentials:     getSMCredentials(env),
+		SMMaxAttempts:     env.GetInt("smMaxAttempts"),
+		SMRateLimit:       env.GetFloat64("smRateLimit"),
+		SMCatalogCacheTTL: env.GetDuration("smCatalogCacheTTL"),
+		K8sQPS:            float32(env.GetFloat64("k8sQPS")),
+		K8sBurst:          env.GetInt("k8sBurst"),
+		K8sRequestTimeout: env.GetDuration("k8sRequestTimeout"),
+	}
+}
+
+// getSMCredentials returns the SM credentials set in the config file or environment, nil if none are set
+func getSMCredentials(env *viper.Viper) map[string]string {
+	var credentials map[string]string
+	for secretKey, keys := range smCredentialKeys {
+		_ = env.BindEnv(keys.configKey, keys.envVar)
+		if value := env.GetString(keys.configKey); value != "" {
+			if credentials == nil {
+				credentials = make(map[string]string)
+			}
+			credentials[secretKey] = value
+		}
 	}
+	return credentials
 }
@@ -4,6 +4,7 @@ go 1.15
 
 require (
 	github.com/DATA-DOG/go-sqlmock v1.5.0 // indirect
+	github.com/Peripli/service-manager v0.19.0
 	github.com/SAP/sap-btp-service-operator v0.1.1
 	github.com/cloudfoundry-community/go-cfenv v1.18.0 // indirect
 	github.com/fasthttp-contrib/websocket v0.0.0-20160511215533-1f3b11f56072 // indirect
@@ -20,6 +21,7 @@ require (
 	github.com/tidwall/sjson v1.1.5 // indirect
 	github.com/valyala/fasthttp v1.21.0 // indirect
 	github.com/yudai/gojsondiff v1.0.0 // indirect
+	golang.org/x/oauth2 v0.0.0-20201208152858-08078c50e5b5
 	golang.org/x/sys v0.0.0-20210309074719-68d13333faf2 // indirect
 	k8s.io/api v0.20.1
 	k8s.io/apimachinery v0.20.1
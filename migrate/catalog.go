@@ -0,0 +1,194 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SAP/sap-btp-service-operator/client/sm"
+	"github.com/SAP/sap-btp-service-operator/client/sm/types"
+)
+
+// catalogQueryBatchSize is the number of IDs in a single plans or offerings field query, to keep the request URL short
+const catalogQueryBatchSize = 50
+
+// catalogCache is the on disk copy of the plans and offerings loaded from the catalog of a subaccount
+type catalogCache struct {
+	Created  time.Time                        `json:"created"`
+	Plans    map[string]types.ServicePlan     `json:"plans"`
+	Services map[string]types.ServiceOffering `json:"services"`
+}
+
+// loadCatalogs loads the plans of the instances to migrate and their offerings into each subaccount.
+// Plans and offerings found in the catalog cache are not loaded from SM again.
+func (m *Migrator) loadCatalogs(instances []serviceInstancePair) error {
+	planIDs := make(map[*subaccount]map[string]bool)
+	for _, pair := range instances {
+		if planIDs[pair.subaccount] == nil {
+			planIDs[pair.subaccount] = make(map[string]bool)
+		}
+		planIDs[pair.subaccount][pair.smInstance.ServicePlanID] = true
+	}
+
+	for _, subaccount := range m.getSubaccounts() {
+		if err := m.loadCatalog(subaccount, planIDs[subaccount]); err != nil {
+			return fmt.Errorf("failed to load catalog using '%s': %v", subaccount.name, err.Error())
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) loadCatalog(subaccount *subaccount, planIDs map[string]bool) error {
+	cache := m.readCatalogCache(subaccount)
+
+	var missingPlans []string
+	for id := range planIDs {
+		if _, ok := cache.Plans[id]; !ok {
+			missingPlans = append(missingPlans, id)
+		}
+	}
+	plans, err := listPlans(subaccount.smClient, missingPlans)
+	if err != nil {
+		return err
+	}
+	for _, plan := range plans {
+		cache.Plans[plan.ID] = plan
+	}
+
+	var missingServices []string
+	for id := range planIDs {
+		plan, ok := cache.Plans[id]
+		if !ok {
+			continue
+		}
+		if _, ok := cache.Services[plan.ServiceOfferingID]; !ok {
+			missingServices = append(missingServices, plan.ServiceOfferingID)
+		}
+	}
+	services, err := listServices(subaccount.smClient, missingServices)
+	if err != nil {
+		return err
+	}
+	for _, service := range services {
+		cache.Services[service.ID] = service
+	}
+
+	if len(plans) > 0 || len(services) > 0 {
+		m.writeCatalogCache(subaccount, cache)
+	}
+	subaccount.plans = cache.Plans
+	subaccount.services = cache.Services
+	return nil
+}
+
+func listPlans(smClient sm.Client, ids []string) ([]types.ServicePlan, error) {
+	var plans []types.ServicePlan
+	for _, query := range getIDQueries(ids) {
+		result, err := smClient.ListPlans(query)
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, result.ServicePlans...)
+	}
+	return plans, nil
+}
+
+func listServices(smClient sm.Client, ids []string) ([]types.ServiceOffering, error) {
+	var services []types.ServiceOffering
+	for _, query := range getIDQueries(ids) {
+		result, err := smClient.ListOfferings(query)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, result.ServiceOfferings...)
+	}
+	return services, nil
+}
+
+// getIDQueries returns the field queries selecting the given IDs, in batches of catalogQueryBatchSize
+func getIDQueries(ids []string) []*sm.Parameters {
+	ids = uniqueStrings(ids)
+	var queries []*sm.Parameters
+	for start := 0; start < len(ids); start += catalogQueryBatchSize {
+		end := start + catalogQueryBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		queries = append(queries, &sm.Parameters{
+			FieldQuery: []string{fmt.Sprintf("id in ('%s')", strings.Join(ids[start:end], "', '"))},
+		})
+	}
+	return queries
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var unique []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+// getCatalogCachePath returns the cache file of the subaccount, named after its credentials so that no URL or client ID is written to disk
+func (m *Migrator) getCatalogCachePath(subaccount *subaccount) string {
+	hash := sha256.Sum256([]byte(subaccount.credentialsKey))
+	return filepath.Join(m.CatalogCacheDir, fmt.Sprintf("catalog-%s.json", hex.EncodeToString(hash[:])))
+}
+
+// readCatalogCache returns the cached catalog of the subaccount, or an empty one if caching is disabled or the cache is missing or expired
+func (m *Migrator) readCatalogCache(subaccount *subaccount) *catalogCache {
+	empty := &catalogCache{
+		Created:  time.Now(),
+		Plans:    make(map[string]types.ServicePlan),
+		Services: make(map[string]types.ServiceOffering),
+	}
+	if m.CatalogCacheDir == "" || m.CatalogCacheTTL <= 0 {
+		return empty
+	}
+
+	content, err := ioutil.ReadFile(m.getCatalogCachePath(subaccount))
+	if err != nil {
+		return empty
+	}
+	cache := &catalogCache{}
+	if err := json.Unmarshal(content, cache); err != nil || time.Since(cache.Created) > m.CatalogCacheTTL {
+		return empty
+	}
+	if cache.Plans == nil {
+		cache.Plans = empty.Plans
+	}
+	if cache.Services == nil {
+		cache.Services = empty.Services
+	}
+	return cache
+}
+
+// writeCatalogCache saves the catalog of the subaccount, failures are reported but do not fail the migration
+func (m *Migrator) writeCatalogCache(subaccount *subaccount, cache *catalogCache) {
+	if m.CatalogCacheDir == "" || m.CatalogCacheTTL <= 0 {
+		return
+	}
+
+	content, err := json.Marshal(cache)
+	if err == nil {
+		err = os.MkdirAll(m.CatalogCacheDir, 0700)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(m.getCatalogCachePath(subaccount), content, 0600)
+	}
+	if err != nil {
+		fmt.Fprintln(output, fmt.Sprintf("could not write the catalog cache: %v", err.Error()))
+	}
+}
@@ -0,0 +1,34 @@
+package migrate
+
+import (
+	"sync"
+)
+
+// cleanupRegistry holds the functions restoring the cluster changes made for the migration
+type cleanupRegistry struct {
+	lock  sync.Mutex
+	funcs []func()
+}
+
+// addCleanup registers a function restoring a cluster change made for the migration. Cleanups run in reverse order
+// of registration when RunCleanups is called, which Migrate and Repair also do when they stop because the run context
+// was cancelled. Cleanups must not use the run context.
+func (m *Migrator) addCleanup(cleanup func()) {
+	m.cleanups.lock.Lock()
+	defer m.cleanups.lock.Unlock()
+
+	m.cleanups.funcs = append(m.cleanups.funcs, cleanup)
+}
+
+// RunCleanups runs the registered cleanups once. Migrate and Repair run them before returning, it only needs to be
+// called when the process exits while they are running.
+func (m *Migrator) RunCleanups() {
+	m.cleanups.lock.Lock()
+	funcs := m.cleanups.funcs
+	m.cleanups.funcs = nil
+	m.cleanups.lock.Unlock()
+
+	for i := len(funcs) - 1; i >= 0; i-- {
+		funcs[i]()
+	}
+}
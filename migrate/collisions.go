@@ -0,0 +1,161 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// NameTemplateData is the data available to the name template used for renaming colliding resources
+type NameTemplateData struct {
+	Name      string
+	Namespace string
+	Kind      string
+}
+
+// resolveNameCollisions detects operator resources and secrets that already exist under the name a migrated resource would get.
+// If a NameTemplate is configured the colliding resources are renamed, otherwise or if the new name collides as well, the collision is reported.
+func (m *Migrator) resolveNameCollisions(ctx context.Context, runCtx context.Context, instances []serviceInstancePair, bindings []serviceBindingPair) (int, bytes.Buffer) {
+	var buffer bytes.Buffer
+	count := 0
+
+	claimedInstances := make(map[string]bool)
+	instanceTargetNames := make(map[string]string)
+	for i := range instances {
+		if runCtx.Err() != nil {
+			return count, buffer
+		}
+		pair := &instances[i]
+		namespace := pair.svcatInstance.Namespace
+		collision, err := m.getInstanceCollision(ctx, *pair, claimedInstances)
+		if err == nil && collision != "" && m.NameTemplate != nil {
+			var name string
+			name, err = m.renderName(pair.svcatInstance.Name, namespace, "ServiceInstance")
+			if err == nil {
+				fmt.Fprintln(output, fmt.Sprintf("instance '%s' in namespace '%s' collides with %s, renaming it to '%s'", pair.svcatInstance.Name, namespace, collision, name))
+				pair.targetName = name
+				collision, err = m.getInstanceCollision(ctx, *pair, claimedInstances)
+			}
+		}
+		if err != nil {
+			count++
+			buffer.WriteString(fmt.Sprintf("instance '%s' in namespace '%s' failed collision check: %v\n", pair.svcatInstance.Name, namespace, err.Error()))
+		} else if collision != "" {
+			count++
+			buffer.WriteString(fmt.Sprintf("instance '%s' in namespace '%s' collides with %s\n", pair.svcatInstance.Name, namespace, collision))
+		}
+		claimedInstances[namespacedName(namespace, pair.targetName)] = true
+		instanceTargetNames[namespacedName(namespace, pair.svcatInstance.Name)] = pair.targetName
+	}
+
+	claimedBindings := make(map[string]bool)
+	claimedSecrets := make(map[string]bool)
+	for i := range bindings {
+		if runCtx.Err() != nil {
+			return count, buffer
+		}
+		pair := &bindings[i]
+		namespace := pair.svcatBinding.Namespace
+		if name, ok := instanceTargetNames[namespacedName(namespace, pair.svcatBinding.Spec.InstanceRef.Name)]; ok {
+			pair.instanceTargetName = name
+		}
+		collision, err := m.getBindingCollision(ctx, *pair, claimedBindings, claimedSecrets)
+		if err == nil && collision != "" && m.NameTemplate != nil {
+			var name string
+			name, err = m.renderName(pair.svcatBinding.Name, namespace, "ServiceBinding")
+			if err == nil {
+				fmt.Fprintln(output, fmt.Sprintf("binding '%s' in namespace '%s' collides with %s, renaming it to '%s'", pair.svcatBinding.Name, namespace, collision, name))
+				pair.targetName = name
+				collision, err = m.getBindingCollision(ctx, *pair, claimedBindings, claimedSecrets)
+			}
+		}
+		if err != nil {
+			count++
+			buffer.WriteString(fmt.Sprintf("binding '%s' in namespace '%s' failed collision check: %v\n", pair.svcatBinding.Name, namespace, err.Error()))
+		} else if collision != "" {
+			count++
+			buffer.WriteString(fmt.Sprintf("binding '%s' in namespace '%s' collides with %s\n", pair.svcatBinding.Name, namespace, collision))
+		}
+		claimedBindings[namespacedName(namespace, pair.targetName)] = true
+		claimedSecrets[namespacedName(namespace, getOperatorSecretName(*pair))] = true
+	}
+
+	return count, buffer
+}
+
+func (m *Migrator) getInstanceCollision(ctx context.Context, pair serviceInstancePair, claimed map[string]bool) (string, error) {
+	namespace := pair.svcatInstance.Namespace
+	if claimed[namespacedName(namespace, pair.targetName)] {
+		return fmt.Sprintf("another migrated instance named '%s'", pair.targetName), nil
+	}
+	existing, err := m.getOperatorInstance(ctx, namespace, pair.targetName)
+	if err != nil || existing == nil || isMigratedInstance(existing, pair.smInstance.ID) {
+		return "", err
+	}
+	return fmt.Sprintf("existing operator instance '%s'", pair.targetName), nil
+}
+
+func (m *Migrator) getBindingCollision(ctx context.Context, pair serviceBindingPair, claimedBindings, claimedSecrets map[string]bool) (string, error) {
+	namespace := pair.svcatBinding.Namespace
+	if claimedBindings[namespacedName(namespace, pair.targetName)] {
+		return fmt.Sprintf("another migrated binding named '%s'", pair.targetName), nil
+	}
+	existing, err := m.getOperatorBinding(ctx, namespace, pair.targetName)
+	if err != nil {
+		return "", err
+	}
+	if existing != nil {
+		if isMigratedBinding(existing, pair.smBinding.ID) {
+			return "", nil
+		}
+		return fmt.Sprintf("existing operator binding '%s'", pair.targetName), nil
+	}
+
+	// the operator binding claims its secret, it must either not exist or be the svcat binding's own secret
+	secretName := getOperatorSecretName(pair)
+	if claimedSecrets[namespacedName(namespace, secretName)] {
+		return fmt.Sprintf("secret '%s' claimed by another migrated binding", secretName), nil
+	}
+	if secretName == pair.svcatBinding.Spec.SecretName {
+		return "", nil
+	}
+	_, err = m.ClientSet.CoreV1().Secrets(namespace).Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return fmt.Sprintf("existing secret '%s'", secretName), nil
+}
+
+func (m *Migrator) renderName(name, namespace, kind string) (string, error) {
+	var buffer bytes.Buffer
+	err := m.NameTemplate.Execute(&buffer, NameTemplateData{Name: name, Namespace: namespace, Kind: kind})
+	if err != nil {
+		return "", fmt.Errorf("failed to render name template: %v", err.Error())
+	}
+	rendered := buffer.String()
+	if errs := validation.IsDNS1123Subdomain(rendered); len(errs) > 0 {
+		return "", fmt.Errorf("rendered name '%s' is invalid: %s", rendered, strings.Join(errs, ", "))
+	}
+	return rendered, nil
+}
+
+// getOperatorSecretName returns the name of the secret the operator binding will manage,
+// it is the svcat binding secret so that the operator takes over the secret mounted by the workloads
+func getOperatorSecretName(pair serviceBindingPair) string {
+	if pair.svcatBinding.Spec.SecretName != "" {
+		return pair.svcatBinding.Spec.SecretName
+	}
+	return pair.targetName
+}
+
+func namespacedName(namespace, name string) string {
+	return namespace + "/" + name
+}
@@ -0,0 +1,63 @@
+package migrate
+
+import (
+	"fmt"
+
+	"github.com/SAP/sap-btp-service-operator/api/v1alpha1"
+	"github.com/kubernetes-sigs/service-catalog/pkg/apis/servicecatalog/v1beta1"
+)
+
+// compatibilityFinding describes a svcat field or secret transform that is not carried over to the operator resource as is
+type compatibilityFinding struct {
+	field   string
+	details string
+}
+
+// getInstanceCompatibilityFindings lists the svcat instance fields that are lost in the operator instance.
+// Plan and offering references are not listed, validatePlan checks that they match the instance in SM.
+func getInstanceCompatibilityFindings(instance *v1beta1.ServiceInstance) []compatibilityFinding {
+	var findings []compatibilityFinding
+	if instance.Spec.UpdateRequests > 0 {
+		findings = append(findings, compatibilityFinding{
+			field:   "updateRequests",
+			details: fmt.Sprintf("counter %d is dropped, the operator has no manual update trigger", instance.Spec.UpdateRequests),
+		})
+	}
+	if instance.Status.DefaultProvisionParameters != nil {
+		findings = append(findings, compatibilityFinding{
+			field:   "status.defaultProvisionParameters",
+			details: "broker default parameters applied by svcat are not part of the operator spec",
+		})
+	}
+	return findings
+}
+
+// getParametersFrom maps the svcat parametersFrom sources, failing on sources the operator cannot express
+func getParametersFrom(sources []v1beta1.ParametersFromSource) ([]v1alpha1.ParametersFromSource, error) {
+	parametersFrom := make([]v1alpha1.ParametersFromSource, 0, len(sources))
+	for i, source := range sources {
+		if source.SecretKeyRef == nil {
+			return nil, fmt.Errorf("parametersFrom[%d] has no secretKeyRef, only secret sources can be migrated", i)
+		}
+		if source.SecretKeyRef.Name == "" || source.SecretKeyRef.Key == "" {
+			return nil, fmt.Errorf("parametersFrom[%d] secretKeyRef should have both name and key", i)
+		}
+		parametersFrom = append(parametersFrom, v1alpha1.ParametersFromSource{
+			SecretKeyRef: &v1alpha1.SecretKeyReference{
+				Name: source.SecretKeyRef.Name,
+				Key:  source.SecretKeyRef.Key,
+			},
+		})
+	}
+	return parametersFrom, nil
+}
+
+func printCompatibilityFindings(kind, name, namespace string, findings []compatibilityFinding) {
+	if len(findings) == 0 {
+		return
+	}
+	fmt.Fprintln(output, fmt.Sprintf("%s '%s' in namespace '%s' has fields that are not fully mapped to the operator:", kind, name, namespace))
+	for _, finding := range findings {
+		fmt.Fprintln(output, fmt.Sprintf("  - %s: %s", finding.field, finding.details))
+	}
+}
@@ -0,0 +1,101 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	svcatImage                = "service-catalog"
+	svcatControllerArg        = "controller-manager"
+	controllerScalingTimeout  = 2 * time.Minute
+	controllerScalingInterval = 5 * time.Second
+)
+
+// scaleDownSvcatController scales the svcat controller-manager deployment to zero so it does not reconcile
+// the resources being migrated. Restoring the original replica count is registered as a cleanup.
+func (m *Migrator) scaleDownSvcatController(ctx context.Context) error {
+	deployment, err := m.findSvcatControllerDeployment(ctx)
+	if err != nil {
+		return err
+	}
+
+	scale, err := m.ClientSet.AppsV1().Deployments(deployment.Namespace).GetScale(ctx, deployment.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get scale of svcat controller '%s/%s': %v", deployment.Namespace, deployment.Name, err.Error())
+	}
+	originalReplicas := scale.Spec.Replicas
+	if originalReplicas == 0 {
+		fmt.Fprintln(output, fmt.Sprintf("svcat controller '%s/%s' is already scaled to zero", deployment.Namespace, deployment.Name))
+		return nil
+	}
+
+	m.addCleanup(func() {
+		fmt.Fprintln(output, fmt.Sprintf("*** Restoring svcat controller '%s/%s' to %d replicas", deployment.Namespace, deployment.Name, originalReplicas))
+		if err := m.scaleDeployment(context.Background(), deployment, originalReplicas); err != nil {
+			fmt.Fprintln(output, fmt.Sprintf("failed to restore svcat controller '%s/%s' to %d replicas, restore it manually. Error: %v",
+				deployment.Namespace, deployment.Name, originalReplicas, err.Error()))
+		}
+	})
+
+	fmt.Fprintln(output, fmt.Sprintf("*** Scaling down svcat controller '%s/%s' from %d replicas", deployment.Namespace, deployment.Name, originalReplicas))
+	if err := m.scaleDeployment(ctx, deployment, 0); err != nil {
+		return fmt.Errorf("failed to scale down svcat controller '%s/%s': %v", deployment.Namespace, deployment.Name, err.Error())
+	}
+	return nil
+}
+
+// scaleDeployment sets the replica count of the deployment and waits for its pods to match it
+func (m *Migrator) scaleDeployment(ctx context.Context, deployment *appsv1.Deployment, replicas int32) error {
+	deployments := m.ClientSet.AppsV1().Deployments(deployment.Namespace)
+	scale, err := deployments.GetScale(ctx, deployment.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	scale.Spec.Replicas = replicas
+	if _, err := deployments.UpdateScale(ctx, deployment.Name, scale, metav1.UpdateOptions{}); err != nil {
+		return err
+	}
+
+	return wait.PollImmediate(controllerScalingInterval, controllerScalingTimeout, func() (bool, error) {
+		current, err := deployments.Get(ctx, deployment.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if replicas == 0 {
+			return current.Status.Replicas == 0, nil
+		}
+		return current.Status.ReadyReplicas >= replicas, nil
+	})
+}
+
+// findSvcatControllerDeployment returns the configured svcat controller-manager deployment, or detects it
+// by looking for a deployment running the service-catalog image as controller-manager
+func (m *Migrator) findSvcatControllerDeployment(ctx context.Context) (*appsv1.Deployment, error) {
+	if m.SvcatControllerDeployment != "" {
+		parts := strings.SplitN(m.SvcatControllerDeployment, "/", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("svcat controller deployment '%s' should be in the format namespace/name", m.SvcatControllerDeployment)
+		}
+		return m.ClientSet.AppsV1().Deployments(parts[0]).Get(ctx, parts[1], metav1.GetOptions{})
+	}
+
+	deployments, err := m.ClientSet.AppsV1().Deployments("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %v", err.Error())
+	}
+	for i := range deployments.Items {
+		for _, container := range deployments.Items[i].Spec.Template.Spec.Containers {
+			if strings.Contains(container.Image, svcatImage) && len(container.Args) > 0 && container.Args[0] == svcatControllerArg {
+				return &deployments.Items[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("svcat controller-manager deployment not found, specify it with --svcat-controller-deployment")
+}
@@ -0,0 +1,132 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/SvcManager/svcat-operator-migrator/redact"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CredentialsPolicy decides which side wins when the binding secret differs from the binding credentials in SM
+type CredentialsPolicy string
+
+const (
+	// CredentialsPolicySecret uploads the secret contents to SM as the binding credentials
+	CredentialsPolicySecret CredentialsPolicy = "secret"
+	// CredentialsPolicySM rewrites the secret from the SM credentials, the same way svcat would, before uploading it
+	CredentialsPolicySM CredentialsPolicy = "sm"
+	// CredentialsPolicyFail fails the binding migration
+	CredentialsPolicyFail CredentialsPolicy = "fail"
+)
+
+// ParseCredentialsPolicy parses the credentials policy flag, an empty policy defaults to CredentialsPolicySecret
+func ParseCredentialsPolicy(policy string) (CredentialsPolicy, error) {
+	switch CredentialsPolicy(policy) {
+	case "":
+		return CredentialsPolicySecret, nil
+	case CredentialsPolicySecret, CredentialsPolicySM, CredentialsPolicyFail:
+		return CredentialsPolicy(policy), nil
+	}
+	return "", fmt.Errorf("invalid credentials policy '%s', expected one of: %s, %s, %s", policy, CredentialsPolicySecret, CredentialsPolicySM, CredentialsPolicyFail)
+}
+
+// reconcileBindingCredentials compares the binding secret with the binding credentials in SM and applies the credentials policy.
+// Returns the secret whose contents should be uploaded to SM.
+func (m *Migrator) reconcileBindingCredentials(ctx context.Context, pair serviceBindingPair, secret *corev1.Secret) (*corev1.Secret, error) {
+	credentials, differences, err := m.compareBindingCredentials(ctx, pair, secret)
+	if err != nil || len(differences) == 0 {
+		return secret, err
+	}
+
+	switch m.CredentialsPolicy {
+	case CredentialsPolicyFail:
+		return nil, fmt.Errorf("secret '%s' differs from the binding credentials in SM in %d keys", secret.Name, len(differences))
+	case CredentialsPolicySM:
+		data, err := getSecretDataFromCredentials(credentials)
+		if err != nil {
+			return nil, err
+		}
+		data, err = m.applySecretTransforms(ctx, pair.svcatBinding, credentials, data)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintln(output, fmt.Sprintf("rewriting secret '%s' from SM credentials", secret.Name))
+		secret.Data = data
+		secret, err = m.ClientSet.CoreV1().Secrets(secret.Namespace).Update(ctx, secret, metav1.UpdateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to rewrite binding's secret '%s'. Error: %v", pair.svcatBinding.Spec.SecretName, err.Error())
+		}
+		return secret, nil
+	}
+	fmt.Fprintln(output, fmt.Sprintf("uploading the contents of secret '%s' as the binding credentials", secret.Name))
+	return secret, nil
+}
+
+// compareBindingCredentials reports the differences between the binding secret and the svcat layout of the binding credentials in SM,
+// with the secret transforms of the binding applied.
+// Returns the SM credentials and the differences, values are never printed.
+func (m *Migrator) compareBindingCredentials(ctx context.Context, pair serviceBindingPair, secret *corev1.Secret) (map[string]interface{}, []string, error) {
+	credentials, err := m.getSMBindingCredentials(pair)
+	if err != nil {
+		return nil, nil, err
+	}
+	expected, err := getSecretDataFromCredentials(credentials)
+	if err != nil {
+		return nil, nil, err
+	}
+	expected, err = m.applySecretTransforms(ctx, pair.svcatBinding, credentials, expected)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	differences := getSecretDataDifferences(secret.Data, expected)
+	if len(differences) > 0 {
+		fmt.Fprintln(output, fmt.Sprintf("secret '%s' of binding '%s' in namespace '%s' differs from the binding credentials in SM:",
+			secret.Name, pair.svcatBinding.Name, pair.svcatBinding.Namespace))
+		for _, difference := range differences {
+			fmt.Fprintln(output, fmt.Sprintf("  - %s", difference))
+		}
+	}
+	return credentials, differences, nil
+}
+
+func (m *Migrator) getSMBindingCredentials(pair serviceBindingPair) (map[string]interface{}, error) {
+	smBinding, err := pair.subaccount.smClient.GetBindingByID(pair.smBinding.ID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credentials of binding '%s' from SM. Error: %v", pair.smBinding.ID, err.Error())
+	}
+
+	credentials := make(map[string]interface{})
+	if len(smBinding.Credentials) > 0 {
+		if err := json.Unmarshal(smBinding.Credentials, &credentials); err != nil {
+			return nil, fmt.Errorf("failed to parse credentials of binding '%s' from SM. Error: %v", pair.smBinding.ID, err.Error())
+		}
+	}
+	redact.RegisterJSON(credentials)
+	return credentials, nil
+}
+
+// getSecretDataDifferences lists the keys that differ between the secret data and the expected data, with values redacted
+func getSecretDataDifferences(actual, expected map[string][]byte) []string {
+	var differences []string
+	for key, value := range actual {
+		expectedValue, ok := expected[key]
+		if !ok {
+			differences = append(differences, fmt.Sprintf("key '%s' is only in the secret", key))
+		} else if !bytes.Equal(value, expectedValue) {
+			differences = append(differences, fmt.Sprintf("key '%s' has a different value (<redacted>)", key))
+		}
+	}
+	for key := range expected {
+		if _, ok := actual[key]; !ok {
+			differences = append(differences, fmt.Sprintf("key '%s' is only in SM", key))
+		}
+	}
+	sort.Strings(differences)
+	return differences
+}
@@ -0,0 +1,118 @@
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"github.com/SAP/sap-btp-service-operator/client/sm"
+	"github.com/SvcManager/svcat-operator-migrator/redact"
+	"github.com/kubernetes-sigs/service-catalog/pkg/apis/servicecatalog/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// analyzeParameterDrift compares the parameters of the instances in SM with the svcat parameters merged with the parametersFrom secrets.
+// The operator instance is created from the svcat parameters, so on its next update the operator may push them back to SM.
+// Parameter values are never printed as they may come from secrets. Returns the number of instances with drifted parameters.
+func (m *Migrator) analyzeParameterDrift(ctx context.Context, runCtx context.Context, instances []serviceInstancePair) int {
+	count := 0
+	for _, pair := range instances {
+		if runCtx.Err() != nil {
+			return count
+		}
+		smParameters, err := m.getSMInstanceParameters(pair)
+		if err != nil {
+			fmt.Fprintln(output, fmt.Sprintf("could not check parameters of instance '%s' in namespace '%s': %v", pair.svcatInstance.Name, pair.svcatInstance.Namespace, err.Error()))
+			continue
+		}
+		svcatParameters, err := m.getSvcatInstanceParameters(ctx, pair.svcatInstance)
+		if err != nil {
+			fmt.Fprintln(output, fmt.Sprintf("could not check parameters of instance '%s' in namespace '%s': %v", pair.svcatInstance.Name, pair.svcatInstance.Namespace, err.Error()))
+			continue
+		}
+
+		differences := getParametersDifferences(svcatParameters, smParameters)
+		if len(differences) == 0 {
+			continue
+		}
+		count++
+		fmt.Fprintln(output, fmt.Sprintf("parameters of instance '%s' in namespace '%s' differ from the instance parameters in SM:", pair.svcatInstance.Name, pair.svcatInstance.Namespace))
+		for _, difference := range differences {
+			fmt.Fprintln(output, fmt.Sprintf("  - %s", difference))
+		}
+	}
+	return count
+}
+
+func (m *Migrator) getSMInstanceParameters(pair serviceInstancePair) (map[string]interface{}, error) {
+	response, err := pair.subaccount.smClient.Call(http.MethodGet, fmt.Sprintf("/v1/service_instances/%s/parameters", pair.smInstance.ID), nil, &sm.Parameters{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get parameters from SM: %v", err.Error())
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get parameters from SM, status code: %d", response.StatusCode)
+	}
+
+	parameters := make(map[string]interface{})
+	if err := json.NewDecoder(response.Body).Decode(&parameters); err != nil {
+		return nil, fmt.Errorf("failed to parse parameters from SM: %v", err.Error())
+	}
+	return parameters, nil
+}
+
+// getSvcatInstanceParameters merges the svcat instance parameters with the parameters of its parametersFrom secrets, as svcat sends them to the broker
+func (m *Migrator) getSvcatInstanceParameters(ctx context.Context, instance *v1beta1.ServiceInstance) (map[string]interface{}, error) {
+	parameters := make(map[string]interface{})
+	if instance.Spec.Parameters != nil && len(instance.Spec.Parameters.Raw) > 0 {
+		if err := json.Unmarshal(instance.Spec.Parameters.Raw, &parameters); err != nil {
+			return nil, fmt.Errorf("failed to parse parameters: %v", err.Error())
+		}
+	}
+
+	for _, source := range instance.Spec.ParametersFrom {
+		if source.SecretKeyRef == nil {
+			continue
+		}
+		secret, err := m.ClientSet.CoreV1().Secrets(instance.Namespace).Get(ctx, source.SecretKeyRef.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get parametersFrom secret '%s': %v", source.SecretKeyRef.Name, err.Error())
+		}
+		value, ok := secret.Data[source.SecretKeyRef.Key]
+		if !ok {
+			return nil, fmt.Errorf("parametersFrom secret '%s' has no key '%s'", source.SecretKeyRef.Name, source.SecretKeyRef.Key)
+		}
+		fromSecret := make(map[string]interface{})
+		if err := json.Unmarshal(value, &fromSecret); err != nil {
+			return nil, fmt.Errorf("key '%s' of parametersFrom secret '%s' is not a JSON object", source.SecretKeyRef.Key, source.SecretKeyRef.Name)
+		}
+		redact.RegisterJSON(fromSecret)
+		for key, parameter := range fromSecret {
+			parameters[key] = parameter
+		}
+	}
+	return parameters, nil
+}
+
+// getParametersDifferences lists the parameters that differ between svcat and SM, without their values
+func getParametersDifferences(svcatParameters, smParameters map[string]interface{}) []string {
+	var differences []string
+	for key, value := range svcatParameters {
+		smValue, ok := smParameters[key]
+		if !ok {
+			differences = append(differences, fmt.Sprintf("parameter '%s' is only in svcat", key))
+		} else if !reflect.DeepEqual(value, smValue) {
+			differences = append(differences, fmt.Sprintf("parameter '%s' has a different value", key))
+		}
+	}
+	for key := range smParameters {
+		if _, ok := svcatParameters[key]; !ok {
+			differences = append(differences, fmt.Sprintf("parameter '%s' is only in SM", key))
+		}
+	}
+	sort.Strings(differences)
+	return differences
+}
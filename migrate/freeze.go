@@ -0,0 +1,206 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/SvcManager/svcat-operator-migrator/sapoperator"
+	"github.com/kubernetes-sigs/service-catalog/pkg/apis/servicecatalog/v1beta1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+const (
+	// freezeLabel marks the namespaces in which svcat resources creation and update is rejected
+	freezeLabel = "svcat-migrator.services.cloud.sap.com/freeze"
+	// migratingLabel exempts the svcat resources being migrated from the freeze, so their finalizers can be removed
+	migratingLabel = "svcat-migrator.services.cloud.sap.com/migrating"
+
+	freezeWebhookConfigurationName = "svcat-migrator-freeze"
+	freezeWebhookName              = "freeze.svcat-migrator.services.cloud.sap.com"
+	// freezeServiceName is a service that does not exist, calls to the webhook fail and requests are rejected
+	freezeServiceName = "svcat-migration-in-progress"
+)
+
+// freezeNamespaces installs a validating webhook rejecting the creation and update of svcat resources in the namespaces being migrated.
+// The webhook points to a service that does not exist so, with a Fail policy, every matching request is rejected.
+// Removing the webhook, the namespace labels and the labels of the resources that were not migrated is registered as a cleanup.
+func (m *Migrator) freezeNamespaces(ctx context.Context, instances []serviceInstancePair, bindings []serviceBindingPair) error {
+	namespaceSet := make(map[string]bool)
+	for _, pair := range instances {
+		namespaceSet[pair.svcatInstance.Namespace] = true
+	}
+	for _, pair := range bindings {
+		namespaceSet[pair.svcatBinding.Namespace] = true
+	}
+	namespaces := make([]string, 0, len(namespaceSet))
+	for namespace := range namespaceSet {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	m.addCleanup(func() {
+		m.unfreezeNamespaces(namespaces)
+	})
+	fmt.Fprintln(output, "*** Exempting the resources being migrated from the freeze")
+	for _, pair := range instances {
+		pair.svcatInstance.Labels = withLabel(pair.svcatInstance.Labels, migratingLabel)
+		err := m.SvcatRestClient.Put().Name(pair.svcatInstance.Name).Namespace(pair.svcatInstance.Namespace).Resource(ServiceInstances).Body(pair.svcatInstance).Do(ctx).Into(pair.svcatInstance)
+		if err != nil {
+			return fmt.Errorf("failed to label svcat instance '%s' in namespace '%s': %v", pair.svcatInstance.Name, pair.svcatInstance.Namespace, err.Error())
+		}
+	}
+	for _, pair := range bindings {
+		pair.svcatBinding.Labels = withLabel(pair.svcatBinding.Labels, migratingLabel)
+		err := m.SvcatRestClient.Put().Name(pair.svcatBinding.Name).Namespace(pair.svcatBinding.Namespace).Resource(ServiceBindings).Body(pair.svcatBinding).Do(ctx).Into(pair.svcatBinding)
+		if err != nil {
+			return fmt.Errorf("failed to label svcat binding '%s' in namespace '%s': %v", pair.svcatBinding.Name, pair.svcatBinding.Namespace, err.Error())
+		}
+	}
+
+	fmt.Fprintln(output, fmt.Sprintf("*** Freezing svcat resources in namespaces %v", namespaces))
+	printFreezeNotice(namespaces)
+	for _, namespace := range namespaces {
+		if err := m.setNamespaceFreezeLabel(ctx, namespace, true); err != nil {
+			return fmt.Errorf("failed to label namespace '%s': %v", namespace, err.Error())
+		}
+	}
+
+	_, err := m.ClientSet.AdmissionregistrationV1().ValidatingWebhookConfigurations().Create(ctx, m.getFreezeWebhookConfiguration(), metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create validating webhook configuration '%s': %v", freezeWebhookConfigurationName, err.Error())
+	}
+	return nil
+}
+
+// printFreezeNotice tells what developers see while the namespaces are frozen, and how to unfreeze them if the migrator
+// is killed before its cleanup runs
+func printFreezeNotice(namespaces []string) {
+	fmt.Fprintln(output, fmt.Sprintf("Creating or updating svcat instances and bindings in these namespaces fails until the migration ends, with an error like:\n"+
+		"  Internal error occurred: failed calling webhook \"%s\": ... service \"%s\" not found", freezeWebhookName, freezeServiceName))
+	fmt.Fprintln(output, fmt.Sprintf("If the migrator is killed before it unfreezes them, unfreeze them with:\n"+
+		"  kubectl delete validatingwebhookconfiguration %s\n"+
+		"  kubectl label namespace %s %s-\n"+
+		"  kubectl label serviceinstances.%s,servicebindings.%s --all-namespaces -l %s %s-",
+		freezeWebhookConfigurationName, strings.Join(namespaces, " "), freezeLabel,
+		sapoperator.SVCATGroupName, sapoperator.SVCATGroupName, migratingLabel, migratingLabel))
+}
+
+func (m *Migrator) unfreezeNamespaces(namespaces []string) {
+	ctx := context.Background()
+	fmt.Fprintln(output, fmt.Sprintf("*** Unfreezing svcat resources in namespaces %v", namespaces))
+	err := m.ClientSet.AdmissionregistrationV1().ValidatingWebhookConfigurations().Delete(ctx, freezeWebhookConfigurationName, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		fmt.Fprintln(output, fmt.Sprintf("failed to delete validating webhook configuration '%s', delete it manually. Error: %v", freezeWebhookConfigurationName, err.Error()))
+	}
+	for _, namespace := range namespaces {
+		if err := m.setNamespaceFreezeLabel(ctx, namespace, false); err != nil {
+			fmt.Fprintln(output, fmt.Sprintf("failed to remove label '%s' from namespace '%s', remove it manually. Error: %v", freezeLabel, namespace, err.Error()))
+		}
+	}
+	// the webhook is gone, so the resources that were not migrated can be updated again
+	m.removeMigratingLabels(ctx)
+}
+
+// removeMigratingLabels removes the migrating label from the svcat resources that are left after the migration,
+// because they failed, were skipped or the migration stopped before them
+func (m *Migrator) removeMigratingLabels(ctx context.Context) {
+	listOptions := &metav1.ListOptions{LabelSelector: migratingLabel}
+	instances := v1beta1.ServiceInstanceList{}
+	err := m.SvcatRestClient.Get().Namespace("").Resource(ServiceInstances).VersionedParams(listOptions, scheme.ParameterCodec).Do(ctx).Into(&instances)
+	if err != nil {
+		fmt.Fprintln(output, fmt.Sprintf("failed to list svcat instances with label '%s', remove it manually. Error: %v", migratingLabel, err.Error()))
+	}
+	for i := range instances.Items {
+		instance := &instances.Items[i]
+		delete(instance.Labels, migratingLabel)
+		err := m.SvcatRestClient.Put().Name(instance.Name).Namespace(instance.Namespace).Resource(ServiceInstances).Body(instance).Do(ctx).Error()
+		if err != nil && !errors.IsNotFound(err) {
+			fmt.Fprintln(output, fmt.Sprintf("failed to remove label '%s' from svcat instance '%s' in namespace '%s', remove it manually. Error: %v", migratingLabel, instance.Name, instance.Namespace, err.Error()))
+		}
+	}
+
+	bindings := v1beta1.ServiceBindingList{}
+	err = m.SvcatRestClient.Get().Namespace("").Resource(ServiceBindings).VersionedParams(listOptions, scheme.ParameterCodec).Do(ctx).Into(&bindings)
+	if err != nil {
+		fmt.Fprintln(output, fmt.Sprintf("failed to list svcat bindings with label '%s', remove it manually. Error: %v", migratingLabel, err.Error()))
+	}
+	for i := range bindings.Items {
+		binding := &bindings.Items[i]
+		delete(binding.Labels, migratingLabel)
+		err := m.SvcatRestClient.Put().Name(binding.Name).Namespace(binding.Namespace).Resource(ServiceBindings).Body(binding).Do(ctx).Error()
+		if err != nil && !errors.IsNotFound(err) {
+			fmt.Fprintln(output, fmt.Sprintf("failed to remove label '%s' from svcat binding '%s' in namespace '%s', remove it manually. Error: %v", migratingLabel, binding.Name, binding.Namespace, err.Error()))
+		}
+	}
+}
+
+func (m *Migrator) setNamespaceFreezeLabel(ctx context.Context, name string, frozen bool) error {
+	namespace, err := m.ClientSet.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if frozen {
+		namespace.Labels = withLabel(namespace.Labels, freezeLabel)
+	} else {
+		delete(namespace.Labels, freezeLabel)
+	}
+	_, err = m.ClientSet.CoreV1().Namespaces().Update(ctx, namespace, metav1.UpdateOptions{})
+	return err
+}
+
+func (m *Migrator) getFreezeWebhookConfiguration() *admissionregistrationv1.ValidatingWebhookConfiguration {
+	failurePolicy := admissionregistrationv1.Fail
+	sideEffects := admissionregistrationv1.SideEffectClassNone
+	timeoutSeconds := int32(1)
+	return &admissionregistrationv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: freezeWebhookConfigurationName,
+		},
+		Webhooks: []admissionregistrationv1.ValidatingWebhook{
+			{
+				Name: freezeWebhookName,
+				ClientConfig: admissionregistrationv1.WebhookClientConfig{
+					Service: &admissionregistrationv1.ServiceReference{
+						Namespace: m.ManagedNamespace,
+						Name:      freezeServiceName,
+					},
+				},
+				Rules: []admissionregistrationv1.RuleWithOperations{
+					{
+						Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create, admissionregistrationv1.Update},
+						Rule: admissionregistrationv1.Rule{
+							APIGroups:   []string{sapoperator.SVCATGroupName},
+							APIVersions: []string{"*"},
+							Resources:   []string{ServiceInstances, ServiceBindings},
+						},
+					},
+				},
+				FailurePolicy: &failurePolicy,
+				NamespaceSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{freezeLabel: "true"},
+				},
+				ObjectSelector: &metav1.LabelSelector{
+					MatchExpressions: []metav1.LabelSelectorRequirement{
+						{Key: migratingLabel, Operator: metav1.LabelSelectorOpDoesNotExist},
+					},
+				},
+				SideEffects:             &sideEffects,
+				TimeoutSeconds:          &timeoutSeconds,
+				AdmissionReviewVersions: []string{"v1"},
+			},
+		},
+	}
+}
+
+func withLabel(labels map[string]string, key string) map[string]string {
+	if labels == nil {
+		labels = make(map[string]string, 1)
+	}
+	labels[key] = "true"
+	return labels
+}
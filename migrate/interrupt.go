@@ -0,0 +1,31 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+)
+
+// Migrate and Repair run their steps with a context of their own and only check the run context before starting the
+// next step, so that an interrupted run or an exceeded run deadline never leaves a resource half migrated.
+
+// getStopReason returns why the run must stop before its next step, or an empty string if it may continue
+func getStopReason(runCtx context.Context) string {
+	switch runCtx.Err() {
+	case nil:
+		return ""
+	case context.DeadlineExceeded:
+		return "the run deadline was exceeded"
+	default:
+		return "the run was interrupted"
+	}
+}
+
+// isStopped returns true and reports why if the run must stop before its next step
+func isStopped(runCtx context.Context) bool {
+	reason := getStopReason(runCtx)
+	if reason == "" {
+		return false
+	}
+	fmt.Fprintln(output, fmt.Sprintf("*** Stopping, %s", reason))
+	return true
+}
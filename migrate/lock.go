@@ -0,0 +1,148 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	lockName            = "svcat-migrator-lock"
+	lockDurationSeconds = 60
+	lockRenewInterval   = lockDurationSeconds * time.Second / 3
+)
+
+// acquireLock takes a lease in the managed namespace so that only one migration runs against the cluster at a time.
+// The lease is renewed while the migration runs, releasing it is registered as a cleanup.
+func (m *Migrator) acquireLock(ctx context.Context) error {
+	leases := m.ClientSet.CoordinationV1().Leases(m.ManagedNamespace)
+	identity := getLockIdentity()
+	duration := int32(lockDurationSeconds)
+	now := metav1.NewMicroTime(time.Now())
+	spec := coordinationv1.LeaseSpec{
+		HolderIdentity:       &identity,
+		LeaseDurationSeconds: &duration,
+		AcquireTime:          &now,
+		RenewTime:            &now,
+	}
+
+	lease, err := leases.Create(ctx, &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: lockName, Namespace: m.ManagedNamespace},
+		Spec:       spec,
+	}, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		existing, getErr := leases.Get(ctx, lockName, metav1.GetOptions{})
+		if getErr != nil {
+			return fmt.Errorf("failed to get migration lock '%s': %v", lockName, getErr.Error())
+		}
+		if !isLeaseExpired(existing) {
+			return fmt.Errorf("another migration is in progress, lock '%s' in namespace '%s' is held by '%s' since %s",
+				lockName, m.ManagedNamespace, getLeaseHolder(existing), getLeaseAcquireTime(existing))
+		}
+		fmt.Fprintln(output, fmt.Sprintf("taking over expired migration lock held by '%s' since %s", getLeaseHolder(existing), getLeaseAcquireTime(existing)))
+		existing.Spec = spec
+		lease, err = leases.Update(ctx, existing, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to acquire migration lock '%s': %v", lockName, err.Error())
+	}
+	fmt.Fprintln(output, fmt.Sprintf("*** Acquired migration lock '%s' as '%s'", lockName, identity))
+
+	stop := make(chan struct{})
+	go m.renewLock(lease, identity, stop)
+	m.addCleanup(func() {
+		close(stop)
+		m.releaseLock(identity)
+	})
+	return nil
+}
+
+func (m *Migrator) renewLock(lease *coordinationv1.Lease, identity string, stop chan struct{}) {
+	leases := m.ClientSet.CoordinationV1().Leases(m.ManagedNamespace)
+	ticker := time.NewTicker(lockRenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if getLeaseHolder(lease) != identity {
+				fmt.Fprintln(output, fmt.Sprintf("WARNING: migration lock '%s' was taken by '%s'", lockName, getLeaseHolder(lease)))
+				return
+			}
+			now := metav1.NewMicroTime(time.Now())
+			lease.Spec.RenewTime = &now
+			renewed, err := leases.Update(context.Background(), lease, metav1.UpdateOptions{})
+			if err != nil {
+				fmt.Fprintln(output, fmt.Sprintf("failed to renew migration lock '%s': %v", lockName, err.Error()))
+				if current, getErr := leases.Get(context.Background(), lockName, metav1.GetOptions{}); getErr == nil {
+					lease = current
+				}
+				continue
+			}
+			lease = renewed
+		}
+	}
+}
+
+func (m *Migrator) releaseLock(identity string) {
+	leases := m.ClientSet.CoordinationV1().Leases(m.ManagedNamespace)
+	lease, err := leases.Get(context.Background(), lockName, metav1.GetOptions{})
+	if err != nil {
+		fmt.Fprintln(output, fmt.Sprintf("failed to get migration lock '%s' for release: %v", lockName, err.Error()))
+		return
+	}
+	if getLeaseHolder(lease) != identity {
+		fmt.Fprintln(output, fmt.Sprintf("migration lock '%s' is held by '%s', not releasing it", lockName, getLeaseHolder(lease)))
+		return
+	}
+	err = leases.Delete(context.Background(), lockName, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: &lease.ResourceVersion},
+	})
+	if err != nil {
+		fmt.Fprintln(output, fmt.Sprintf("failed to release migration lock '%s', it will expire in %d seconds: %v", lockName, lockDurationSeconds, err.Error()))
+		return
+	}
+	fmt.Fprintln(output, fmt.Sprintf("*** Released migration lock '%s'", lockName))
+}
+
+func isLeaseExpired(lease *coordinationv1.Lease) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	return time.Now().After(expiry)
+}
+
+func getLeaseHolder(lease *coordinationv1.Lease) string {
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *lease.Spec.HolderIdentity
+}
+
+func getLeaseAcquireTime(lease *coordinationv1.Lease) string {
+	if lease.Spec.AcquireTime == nil {
+		return "unknown time"
+	}
+	return lease.Spec.AcquireTime.Format(time.RFC3339)
+}
+
+// getLockIdentity identifies the migration run holding the lock by user, host and process
+func getLockIdentity() string {
+	username := "unknown"
+	if current, err := user.Current(); err == nil {
+		username = current.Username
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s@%s (pid %d)", username, hostname, os.Getpid())
+}
@@ -5,11 +5,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"net/http"
+	"os"
+	"text/template"
+	"time"
 
+	"github.com/SvcManager/svcat-operator-migrator/redact"
 	"github.com/SvcManager/svcat-operator-migrator/sapoperator"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/flowcontrol"
 
 	"github.com/SAP/sap-btp-service-operator/api/v1alpha1"
 	"github.com/SAP/sap-btp-service-operator/client/sm"
@@ -29,18 +33,53 @@ type Migrator struct {
 	SapOperatorRestClient *rest.RESTClient
 	ClientSet             *kubernetes.Clientset
 	ClusterID             string
-	Services              map[string]types.ServiceOffering
-	Plans                 map[string]types.ServicePlan
+	WaitForStable         time.Duration
+	SkipUnstable          bool
+	NameTemplate          *template.Template
+	// ScaleDownSvcatController scales the svcat controller-manager to zero while resources are migrated
+	ScaleDownSvcatController bool
+	// SvcatControllerDeployment is the namespace/name of the svcat controller-manager deployment, detected if empty
+	SvcatControllerDeployment string
+	// FailOnSecretTransforms stops the migration if bindings have secret transforms the operator cannot express
+	FailOnSecretTransforms bool
+	// FailOnParameterDrift stops the migration if instance parameters in SM differ from the svcat parameters
+	FailOnParameterDrift bool
+	// RecreateMissingSecrets recreates missing binding secrets from the binding credentials in SM
+	RecreateMissingSecrets bool
+	// CredentialsPolicy decides which side wins when a binding secret differs from the binding credentials in SM
+	CredentialsPolicy CredentialsPolicy
+	// FreezeNamespaces rejects svcat resources creation and update in the migrated namespaces while resources are migrated
+	FreezeNamespaces bool
+	ManagedNamespace string
+	// CatalogCacheDir is where the plans and offerings loaded from SM are cached, CatalogCacheTTL how long they are reused
+	CatalogCacheDir string
+	CatalogCacheTTL time.Duration
+
+	// defaultSubaccount is configured by the operator secret in the managed namespace, namespaceSubaccounts by namespace specific secrets
+	defaultSubaccount    *subaccount
+	namespaceSubaccounts map[string]*subaccount
+	// smRetries records the retried SM requests for the summary
+	smRetries *retryReport
+
+	cleanups cleanupRegistry
 }
 
 type serviceInstancePair struct {
 	svcatInstance *v1beta1.ServiceInstance
 	smInstance    *types.ServiceInstance
+	subaccount    *subaccount
+	// targetName is the name of the operator instance, it differs from the svcat name only if renamed due to a collision
+	targetName string
 }
 
 type serviceBindingPair struct {
 	svcatBinding *v1beta1.ServiceBinding
 	smBinding    *types.ServiceBinding
+	subaccount   *subaccount
+	// targetName is the name of the operator binding, it differs from the svcat name only if renamed due to a collision
+	targetName string
+	// instanceTargetName is the name of the operator instance the binding refers to
+	instanceTargetName string
 }
 
 type ExecutionMode int
@@ -51,165 +90,364 @@ const (
 	DryRun
 )
 
+// output is where the migration is reported, credentials are redacted from everything written to it
+var output = redact.Writer(os.Stdout)
+
 const ServiceInstances = "serviceinstances"
 const ServiceBindings = "servicebindings"
 
-func NewMigrator(ctx context.Context, kubeconfig string, managedNamespace string) *Migrator {
+// smIDAnnotation holds the SM ID of a migrated operator resource, to recognize it before the operator sets its status
+const smIDAnnotation = "sm_id"
+
+// svcatListPageSize is the number of svcat resources listed per request
+const svcatListPageSize = 500
+
+func NewMigrator(ctx context.Context, kubeconfig string, managedNamespace string, k8sClientOptions K8sClientOptions, smClientOptions SMClientOptions) *Migrator {
+	smClientOptions.retries = &retryReport{}
+	if smClientOptions.RateLimit > 0 {
+		burst := int(smClientOptions.RateLimit)
+		if burst < 1 {
+			burst = 1
+		}
+		smClientOptions.limiter = flowcontrol.NewTokenBucketRateLimiter(float32(smClientOptions.RateLimit), burst)
+	}
+
 	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
-	cobra.CheckErr(err)
+	cobra.CheckErr(redact.Error(err))
+	k8sClientOptions.apply(config)
 
 	err = sapoperator.AddToScheme(scheme.Scheme)
-	cobra.CheckErr(err)
+	cobra.CheckErr(redact.Error(err))
 
 	clientset, err := kubernetes.NewForConfig(config)
-	cobra.CheckErr(err)
+	cobra.CheckErr(redact.Error(err))
 
-	secret, err := clientset.CoreV1().Secrets(managedNamespace).Get(ctx, "sap-btp-service-operator", metav1.GetOptions{})
-	cobra.CheckErr(err)
+	var secret *corev1.Secret
+	if smClientOptions.Credentials != nil {
+		cobra.CheckErr(validateSMCredentials(smClientOptions.Credentials))
+		fmt.Fprintln(output, "Using SM credentials from the CLI configuration instead of the operator secret")
+		secret = &corev1.Secret{Data: smClientOptions.Credentials}
+	} else {
+		secret, err = clientset.CoreV1().Secrets(managedNamespace).Get(ctx, operatorSecretName, metav1.GetOptions{})
+		cobra.CheckErr(redact.Error(err))
+	}
 
 	configMap, err := clientset.CoreV1().ConfigMaps(managedNamespace).Get(ctx, "sap-btp-operator-config", metav1.GetOptions{})
-	cobra.CheckErr(err)
+	cobra.CheckErr(redact.Error(err))
 
-	return getMigrator(
-		GetSMClient(ctx, secret),
+	migrator := getMigrator(
+		GetSMClient(ctx, secret, smClientOptions),
+		getCredentialsKey(secret),
 		GetK8sClient(config, sapoperator.SVCATGroupName, sapoperator.SVCATGroupVersion),
 		GetK8sClient(config, sapoperator.OperatorGroupName, sapoperator.OperatorGroupVersion),
 		configMap.Data["CLUSTER_ID"],
+		managedNamespace,
 		clientset,
 	)
+	if smClientOptions.Credentials == nil {
+		migrator.loadNamespaceSubaccounts(ctx, secret, smClientOptions)
+	}
+	migrator.smRetries = smClientOptions.retries
+	return migrator
 }
 
-func getMigrator(smClient sm.Client, svcatRestClient, sapOperatorRestClient *rest.RESTClient, clusterID string, clientset *kubernetes.Clientset) *Migrator {
-	fmt.Println(fmt.Sprintf("Migrator initialized with cluster ID '%s'", clusterID))
+func getMigrator(smClient sm.Client, credentialsKey string, svcatRestClient, sapOperatorRestClient *rest.RESTClient, clusterID, managedNamespace string, clientset *kubernetes.Clientset) *Migrator {
+	fmt.Fprintln(output, fmt.Sprintf("Migrator initialized with cluster ID '%s'", clusterID))
 	return &Migrator{
 		SMClient:              smClient,
 		SvcatRestClient:       svcatRestClient,
 		SapOperatorRestClient: sapOperatorRestClient,
 		ClientSet:             clientset,
 		ClusterID:             clusterID,
-		Services:              getServices(smClient),
-		Plans:                 getPlans(smClient),
+		ManagedNamespace:      managedNamespace,
+		defaultSubaccount:     newSubaccount(namespacedName(managedNamespace, operatorSecretName), credentialsKey, smClient),
 	}
 }
 
-func (m *Migrator) Migrate(ctx context.Context, executionMode ExecutionMode) {
-	parameters := &sm.Parameters{
-		FieldQuery: []string{
-			fmt.Sprintf("context/clusterid eq '%s'", m.ClusterID),
-		},
+// Migrate migrates the svcat resources to the operator. When runCtx is cancelled or its deadline passes,
+// the step in progress is completed and the migration stops before the next one.
+func (m *Migrator) Migrate(runCtx context.Context, executionMode ExecutionMode) {
+	ctx := context.Background()
+	defer m.RunCleanups()
+	defer m.smRetries.print()
+	if executionMode != DryRun {
+		if err := m.acquireLock(ctx); err != nil {
+			fmt.Fprintln(output, err.Error())
+			return
+		}
 	}
 
-	smInstances, err := m.SMClient.ListInstances(parameters)
-	cobra.CheckErr(err)
-	fmt.Println(fmt.Sprintf("*** Fetched %v instances from SM", len(smInstances.ServiceInstances)))
+	instancesToMigrate, bindingsToMigrate := m.getResourcesToMigrate(ctx)
+	if len(instancesToMigrate) == 0 && len(bindingsToMigrate) == 0 {
+		fmt.Fprintln(output, "no svcat instances or bindings found for migration")
+		return
+	}
+	fmt.Fprintln(output, fmt.Sprintf("*** found %d instances and %d bindings to migrate", len(instancesToMigrate), len(bindingsToMigrate)))
+	if isStopped(runCtx) {
+		return
+	}
 
-	smBindings, err := m.SMClient.ListBindings(parameters)
-	cobra.CheckErr(err)
-	fmt.Println(fmt.Sprintf("*** Fetched %v bindings from SM", len(smBindings.ServiceBindings)))
+	fmt.Fprintln(output, "*** Checking resources are stable")
+	instancesToMigrate, bindingsToMigrate, unstableCount, unstableMsg := m.ensureStable(ctx, runCtx, instancesToMigrate, bindingsToMigrate)
+	if isStopped(runCtx) {
+		return
+	}
+	if unstableCount > 0 {
+		fmt.Fprintln(output, fmt.Sprintf("Found %d unstable resources, use --wait-for-stable or --skip-unstable to proceed:", unstableCount))
+		fmt.Fprintln(output, unstableMsg.String())
+		return
+	}
+	if len(instancesToMigrate) == 0 && len(bindingsToMigrate) == 0 {
+		fmt.Fprintln(output, "no stable svcat instances or bindings left for migration")
+		return
+	}
 
-	svcatInstances := v1beta1.ServiceInstanceList{}
-	err = m.SvcatRestClient.Get().Namespace("").Resource(ServiceInstances).Do(ctx).Into(&svcatInstances)
-	cobra.CheckErr(err)
-	fmt.Println(fmt.Sprintf("*** Fetched %v svcat instances from cluster", len(svcatInstances.Items)))
+	fmt.Fprintln(output, "*** Checking for name collisions")
+	collisionsCount, collisionsMsg := m.resolveNameCollisions(ctx, runCtx, instancesToMigrate, bindingsToMigrate)
+	if isStopped(runCtx) {
+		return
+	}
+	if collisionsCount > 0 {
+		fmt.Fprintln(output, fmt.Sprintf("Found %d name collisions, use --name-template to rename the colliding resources:", collisionsCount))
+		fmt.Fprintln(output, collisionsMsg.String())
+		return
+	}
 
-	svcatBindings := v1beta1.ServiceBindingList{}
-	err = m.SvcatRestClient.Get().Namespace("").Resource(ServiceBindings).Do(ctx).Into(&svcatBindings)
-	cobra.CheckErr(err)
-	fmt.Println(fmt.Sprintf("*** Fetched %v svcat bindings from cluster", len(svcatBindings.Items)))
+	fmt.Fprintln(output, "*** Analyzing binding secret transforms")
+	if count := m.analyzeSecretTransforms(bindingsToMigrate); count > 0 && m.FailOnSecretTransforms {
+		fmt.Fprintln(output, fmt.Sprintf("Found %d bindings with secret transforms, remove --fail-on-secret-transforms to migrate them anyway", count))
+		return
+	}
 
-	fmt.Println("*** Preparing resources")
-	instancesToMigrate := m.getInstancesToMigrate(smInstances, svcatInstances)
-	bindingsToMigrate := m.getBindingsToMigrate(smBindings, svcatBindings)
-	if len(instancesToMigrate) == 0 && len(bindingsToMigrate) == 0 {
-		fmt.Println("no svcat instances or bindings found for migration")
+	fmt.Fprintln(output, "*** Checking instance parameters drift")
+	driftCount := m.analyzeParameterDrift(ctx, runCtx, instancesToMigrate)
+	if isStopped(runCtx) {
 		return
 	}
-	fmt.Println(fmt.Sprintf("*** found %d instances and %d bindings to migrate", len(instancesToMigrate), len(bindingsToMigrate)))
+	if driftCount > 0 {
+		if m.FailOnParameterDrift {
+			fmt.Fprintln(output, fmt.Sprintf("Found %d instances whose parameters differ from SM, align the svcat parameters or remove --fail-on-parameter-drift to migrate them anyway", driftCount))
+			return
+		}
+		fmt.Fprintln(output, fmt.Sprintf("Found %d instances whose parameters differ from SM, the operator may push the svcat parameters to SM on its next update", driftCount))
+	}
 
 	if executionMode != RunWithoutValidation {
-		fmt.Println("*** Validating")
-		failuresCount, validationErrorsMsg := m.validate(ctx, instancesToMigrate, bindingsToMigrate)
+		fmt.Fprintln(output, "*** Validating")
+		failuresCount, validationErrorsMsg := m.validate(ctx, runCtx, instancesToMigrate, bindingsToMigrate)
+		if isStopped(runCtx) {
+			return
+		}
 		if failuresCount > 0 {
-			fmt.Println(fmt.Sprintf("Validation failed got %d validation errors:", failuresCount))
-			fmt.Println(validationErrorsMsg.String())
+			fmt.Fprintln(output, fmt.Sprintf("Validation failed got %d validation errors:", failuresCount))
+			fmt.Fprintln(output, validationErrorsMsg.String())
 			return
 		} else {
-			fmt.Println("*** Validation completed successfully")
+			fmt.Fprintln(output, "*** Validation completed successfully")
 		}
 		if executionMode == DryRun {
 			return
 		}
 	} else {
-		fmt.Println("*** Validation is skipped...")
+		fmt.Fprintln(output, "*** Validation is skipped...")
+	}
+	if isStopped(runCtx) {
+		return
+	}
+
+	if m.ScaleDownSvcatController {
+		if err := m.scaleDownSvcatController(ctx); err != nil {
+			fmt.Fprintln(output, err.Error())
+			return
+		}
+	}
+	if m.FreezeNamespaces {
+		if err := m.freezeNamespaces(ctx, instancesToMigrate, bindingsToMigrate); err != nil {
+			fmt.Fprintln(output, err.Error())
+			return
+		}
 	}
 
 	var failuresBuffer bytes.Buffer
+	defer func() {
+		if failuresBuffer.Len() > 0 {
+			fmt.Fprintln(output, "*** Migration failures summary:")
+			fmt.Fprintln(output, failuresBuffer.String())
+		}
+	}()
+	// handleFailure records a failed resource and returns true if the migration must abort
+	handleFailure := func(err error) bool {
+		if isDeprovisionTriggered(err) {
+			return true
+		}
+		fmt.Fprintln(output, err.Error())
+		failuresBuffer.WriteString(err.Error() + "\n")
+		return false
+	}
+
+	stopped := false
+	migratedInstances, migratedBindings := 0, 0
+	var rechecks []func() error
 	for _, pair := range instancesToMigrate {
-		err := m.migrateInstance(ctx, pair)
-		if err != nil {
-			fmt.Println(err.Error())
-			failuresBuffer.WriteString(err.Error() + "\n")
+		if stopped = isStopped(runCtx); stopped {
+			break
+		}
+		if err := m.migrateInstance(ctx, pair); err != nil {
+			if handleFailure(err) {
+				return
+			}
+			continue
+		}
+		migratedInstances++
+		if pair.svcatInstance.DeletionTimestamp.IsZero() {
+			pair := pair
+			rechecks = append(rechecks, func() error { return checkInstanceSurvived(pair) })
+		}
+	}
+	for _, err := range m.recheckSurvived(rechecks) {
+		if handleFailure(err) {
+			return
 		}
 	}
 
+	rechecks = nil
 	for _, pair := range bindingsToMigrate {
-		err := m.migrateBinding(ctx, pair)
-		if err != nil {
-			fmt.Println(err.Error())
-			failuresBuffer.WriteString(err.Error() + "\n")
+		if stopped = stopped || isStopped(runCtx); stopped {
+			break
+		}
+		if err := m.migrateBinding(ctx, pair); err != nil {
+			if handleFailure(err) {
+				return
+			}
+			continue
+		}
+		migratedBindings++
+		if pair.svcatBinding.DeletionTimestamp.IsZero() {
+			pair := pair
+			rechecks = append(rechecks, func() error { return checkBindingSurvived(pair) })
+		}
+	}
+	for _, err := range m.recheckSurvived(rechecks) {
+		if handleFailure(err) {
+			return
 		}
 	}
 
-	if failuresBuffer.Len() == 0 {
-		fmt.Println("*** Migration completed successfully")
-	} else {
-		fmt.Println("*** Migration failures summary:")
-		fmt.Println(failuresBuffer.String())
+	if stopped {
+		fmt.Fprintln(output, fmt.Sprintf("*** Migration stopped after migrating %d of %d instances and %d of %d bindings, run the migration again to migrate the remaining resources",
+			migratedInstances, len(instancesToMigrate), migratedBindings, len(bindingsToMigrate)))
+	} else if failuresBuffer.Len() == 0 {
+		fmt.Fprintln(output, "*** Migration completed successfully")
 	}
 }
 
-func (m *Migrator) getInstancesToMigrate(smInstances *types.ServiceInstances, svcatInstances v1beta1.ServiceInstanceList) []serviceInstancePair {
-	validInstances := make([]serviceInstancePair, 0)
-	for _, svcat := range svcatInstances.Items {
-		var smInstance *types.ServiceInstance
-		for _, instance := range smInstances.ServiceInstances {
-			if instance.ID == svcat.Spec.ExternalID {
-				smInstance = &instance
-				break
-			}
+// getResourcesToMigrate fetches the svcat resources of the cluster, matches them with their SM counterparts
+// and loads the plans and offerings of the matched instances
+func (m *Migrator) getResourcesToMigrate(ctx context.Context) ([]serviceInstancePair, []serviceBindingPair) {
+	svcatInstances, svcatBindings := m.fetchResources(ctx)
+
+	fmt.Fprintln(output, "*** Preparing resources")
+	instances, bindings := m.getInstancesToMigrate(svcatInstances), m.getBindingsToMigrate(svcatBindings)
+	cobra.CheckErr(redact.Error(m.loadCatalogs(instances)))
+	return instances, bindings
+}
+
+// fetchResources fetches the SM resources of the cluster into each subaccount and returns the svcat resources from all namespaces
+func (m *Migrator) fetchResources(ctx context.Context) (v1beta1.ServiceInstanceList, v1beta1.ServiceBindingList) {
+	parameters := withLastOperation(fmt.Sprintf("context/clusterid eq '%s'", m.ClusterID))
+
+	var err error
+	subaccounts := m.getSubaccounts()
+	for _, subaccount := range subaccounts {
+		source := "SM"
+		if len(subaccounts) > 1 {
+			source = fmt.Sprintf("SM using '%s'", subaccount.name)
+		}
+
+		subaccount.smInstances, err = subaccount.smClient.ListInstances(parameters)
+		cobra.CheckErr(redact.Error(err))
+		fmt.Fprintln(output, fmt.Sprintf("*** Fetched %v instances from %s", len(subaccount.smInstances.ServiceInstances), source))
+
+		subaccount.smBindings, err = subaccount.smClient.ListBindings(parameters)
+		cobra.CheckErr(redact.Error(err))
+		fmt.Fprintln(output, fmt.Sprintf("*** Fetched %v bindings from %s", len(subaccount.smBindings.ServiceBindings), source))
+
+		subaccount.indexSMResources()
+	}
+
+	svcatInstances := v1beta1.ServiceInstanceList{}
+	for {
+		page := v1beta1.ServiceInstanceList{}
+		err = m.listSvcatPage(ctx, ServiceInstances, svcatInstances.Continue).Into(&page)
+		cobra.CheckErr(redact.Error(err))
+		svcatInstances.Items = append(svcatInstances.Items, page.Items...)
+		if svcatInstances.Continue = page.Continue; page.Continue == "" {
+			break
 		}
-		if smInstance == nil {
-			fmt.Println(fmt.Sprintf("svcat instance name '%s' id '%s' (%s) not found in SM, skipping it...", svcat.Name, svcat.Spec.ExternalID, svcat.Name))
+	}
+	fmt.Fprintln(output, fmt.Sprintf("*** Fetched %v svcat instances from cluster", len(svcatInstances.Items)))
+
+	svcatBindings := v1beta1.ServiceBindingList{}
+	for {
+		page := v1beta1.ServiceBindingList{}
+		err = m.listSvcatPage(ctx, ServiceBindings, svcatBindings.Continue).Into(&page)
+		cobra.CheckErr(redact.Error(err))
+		svcatBindings.Items = append(svcatBindings.Items, page.Items...)
+		if svcatBindings.Continue = page.Continue; page.Continue == "" {
+			break
+		}
+	}
+	fmt.Fprintln(output, fmt.Sprintf("*** Fetched %v svcat bindings from cluster", len(svcatBindings.Items)))
+
+	return svcatInstances, svcatBindings
+}
+
+// listSvcatPage lists a page of svcat resources from all namespaces, continuing the list from the given token
+func (m *Migrator) listSvcatPage(ctx context.Context, resource string, continueToken string) rest.Result {
+	return m.SvcatRestClient.Get().
+		Namespace("").
+		Resource(resource).
+		VersionedParams(&metav1.ListOptions{Limit: svcatListPageSize, Continue: continueToken}, scheme.ParameterCodec).
+		Do(ctx)
+}
+
+func (m *Migrator) getInstancesToMigrate(svcatInstances v1beta1.ServiceInstanceList) []serviceInstancePair {
+	validInstances := make([]serviceInstancePair, 0)
+	for i := range svcatInstances.Items {
+		svcat := &svcatInstances.Items[i]
+		subaccount := m.getSubaccount(svcat.Namespace)
+		smInstance, ok := subaccount.smInstancesByID[svcat.Spec.ExternalID]
+		if !ok {
+			fmt.Fprintln(output, fmt.Sprintf("svcat instance name '%s' id '%s' (%s) not found in SM, skipping it...", svcat.Name, svcat.Spec.ExternalID, svcat.Name))
 			continue
 		}
-		svcInstance := svcat
 		validInstances = append(validInstances, serviceInstancePair{
-			svcatInstance: &svcInstance,
+			svcatInstance: svcat,
 			smInstance:    smInstance,
+			subaccount:    subaccount,
+			targetName:    svcat.Name,
 		})
 	}
 
 	return validInstances
 }
 
-func (m *Migrator) getBindingsToMigrate(smBindings *types.ServiceBindings, svcatBindings v1beta1.ServiceBindingList) []serviceBindingPair {
+func (m *Migrator) getBindingsToMigrate(svcatBindings v1beta1.ServiceBindingList) []serviceBindingPair {
 	validBindings := make([]serviceBindingPair, 0)
-	for _, svcat := range svcatBindings.Items {
-		var smBinding *types.ServiceBinding
-		for _, binding := range smBindings.ServiceBindings {
-			if binding.ID == svcat.Spec.ExternalID {
-				smBinding = &binding
-				break
-			}
-		}
-		if smBinding == nil {
-			fmt.Println(fmt.Sprintf("svcat binding name '%s' id '%s' (%s) not found in SM, skipping it...", svcat.Name, svcat.Spec.ExternalID, svcat.Name))
+	for i := range svcatBindings.Items {
+		svcat := &svcatBindings.Items[i]
+		subaccount := m.getSubaccount(svcat.Namespace)
+		smBinding, ok := subaccount.smBindingsByID[svcat.Spec.ExternalID]
+		if !ok {
+			fmt.Fprintln(output, fmt.Sprintf("svcat binding name '%s' id '%s' (%s) not found in SM, skipping it...", svcat.Name, svcat.Spec.ExternalID, svcat.Name))
 			continue
 		}
-		svcBinding := svcat
 		validBindings = append(validBindings, serviceBindingPair{
-			svcatBinding: &svcBinding,
-			smBinding:    smBinding,
+			svcatBinding:       svcat,
+			smBinding:          smBinding,
+			subaccount:         subaccount,
+			targetName:         svcat.Name,
+			instanceTargetName: svcat.Spec.InstanceRef.Name,
 		})
 	}
 
@@ -217,8 +455,23 @@ func (m *Migrator) getBindingsToMigrate(smBindings *types.ServiceBindings, svcat
 }
 
 func (m *Migrator) migrateInstanceDryRun(ctx context.Context, pair serviceInstancePair) error {
-	instance := m.getInstanceStruct(pair)
-	err := m.SapOperatorRestClient.Post().
+	existing, err := m.getOperatorInstance(ctx, pair.svcatInstance.Namespace, pair.targetName)
+	if err != nil {
+		return err
+	}
+	if existing != nil && isMigratedInstance(existing, pair.smInstance.ID) {
+		fmt.Fprintln(output, fmt.Sprintf("svcat instance '%s' in namespace '%s' was already migrated by a previous run", pair.svcatInstance.Name, pair.svcatInstance.Namespace))
+		return nil
+	}
+
+	if err := m.validatePlan(ctx, pair); err != nil {
+		return err
+	}
+	instance, err := m.getInstanceStruct(pair)
+	if err != nil {
+		return err
+	}
+	err = m.SapOperatorRestClient.Post().
 		Namespace(pair.svcatInstance.Namespace).
 		Resource(ServiceInstances).
 		Param("dryRun", "All").
@@ -232,8 +485,34 @@ func (m *Migrator) migrateInstanceDryRun(ctx context.Context, pair serviceInstan
 }
 
 func (m *Migrator) migrateBindingDryRun(ctx context.Context, pair serviceBindingPair) error {
-	binding := m.getBindingStruct(pair)
-	err := m.SapOperatorRestClient.Post().
+	existing, err := m.getOperatorBinding(ctx, pair.svcatBinding.Namespace, pair.targetName)
+	if err != nil {
+		return err
+	}
+	if existing != nil && isMigratedBinding(existing, pair.smBinding.ID) {
+		fmt.Fprintln(output, fmt.Sprintf("svcat binding '%s' in namespace '%s' was already migrated by a previous run", pair.svcatBinding.Name, pair.svcatBinding.Namespace))
+		return nil
+	}
+
+	secret, err := m.getBindingSecret(ctx, pair)
+	if err != nil {
+		return err
+	}
+	if secret != nil {
+		_, differences, err := m.compareBindingCredentials(ctx, pair, secret)
+		if err != nil {
+			return err
+		}
+		if len(differences) > 0 && m.CredentialsPolicy == CredentialsPolicyFail {
+			return fmt.Errorf("secret '%s' differs from the binding credentials in SM in %d keys", secret.Name, len(differences))
+		}
+	}
+
+	binding, err := m.getBindingStruct(pair)
+	if err != nil {
+		return err
+	}
+	err = m.SapOperatorRestClient.Post().
 		Namespace(pair.svcatBinding.Namespace).
 		Resource(ServiceBindings).
 		Param("dryRun", "All").
@@ -248,157 +527,301 @@ func (m *Migrator) migrateBindingDryRun(ctx context.Context, pair serviceBinding
 
 func (m *Migrator) migrateInstance(ctx context.Context, pair serviceInstancePair) error {
 
-	fmt.Println(fmt.Sprintf("migrating service instance '%s' in namespace '%s' (smID: '%s')", pair.svcatInstance.Name, pair.svcatInstance.Namespace, pair.svcatInstance.Spec.ExternalID))
+	fmt.Fprintln(output, fmt.Sprintf("migrating service instance '%s' in namespace '%s' (smID: '%s')", pair.svcatInstance.Name, pair.svcatInstance.Namespace, pair.svcatInstance.Spec.ExternalID))
 
-	//set k8s label
-	requestBody := fmt.Sprintf(`{"k8sname": "%s"}`, pair.svcatInstance.Name)
-	buffer := bytes.NewBuffer([]byte(requestBody))
-	response, err := m.SMClient.Call(http.MethodPut, fmt.Sprintf("/v1/migrate/service_instances/%s", pair.smInstance.ID), buffer, &sm.Parameters{})
-	if err != nil || response.StatusCode != http.StatusOK {
-		if response != nil {
-			fmt.Println(response.StatusCode)
+	res, err := m.getOperatorInstance(ctx, pair.svcatInstance.Namespace, pair.targetName)
+	if err != nil {
+		return fmt.Errorf("failed to get operator instance '%s'. Error: %v", pair.targetName, err.Error())
+	}
+	if res != nil && isMigratedInstance(res, pair.smInstance.ID) {
+		fmt.Fprintln(output, "instance was already migrated by a previous run, continuing with the remaining steps")
+	} else {
+		instance, err := m.getInstanceStruct(pair)
+		if err != nil {
+			return err
 		}
-		return fmt.Errorf("failed to add k8s label to service instance name: %s, ID: %s", pair.smInstance.Name, pair.smInstance.ID)
+
+		//set k8s label
+		requestBody := fmt.Sprintf(`{"k8sname": "%s"}`, pair.targetName)
+		err = callMigrateAPI(pair.subaccount.smClient, fmt.Sprintf("/v1/migrate/service_instances/%s", pair.smInstance.ID), requestBody)
+		if err != nil {
+			return fmt.Errorf("failed to add k8s label to service instance name: %s, ID: %s. Error: %w", pair.smInstance.Name, pair.smInstance.ID, err)
+		}
+
+		res, err = m.createOperatorInstance(ctx, instance)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = m.completeInstanceMigration(ctx, pair, res)
+	if err != nil {
+		return err
 	}
+	fmt.Fprintln(output, "instance migrated successfully")
+	return nil
+}
 
-	instance := m.getInstanceStruct(pair)
+func (m *Migrator) createOperatorInstance(ctx context.Context, instance *v1alpha1.ServiceInstance) (*v1alpha1.ServiceInstance, error) {
 	res := &v1alpha1.ServiceInstance{}
-	err = m.SapOperatorRestClient.Post().
-		Namespace(pair.svcatInstance.Namespace).
+	err := m.SapOperatorRestClient.Post().
+		Namespace(instance.Namespace).
 		Resource(ServiceInstances).
 		Body(instance).
 		Do(ctx).
 		Into(res)
 
 	if err != nil {
-		return fmt.Errorf("failed to create service instance: %v", err.Error())
+		return nil, fmt.Errorf("failed to create service instance: %v", err.Error())
 	}
+	return res, nil
+}
 
+// completeInstanceMigration performs the steps following the creation of the operator instance
+func (m *Migrator) completeInstanceMigration(ctx context.Context, pair serviceInstancePair, res *v1alpha1.ServiceInstance) error {
 	if !pair.svcatInstance.DeletionTimestamp.IsZero() {
-		fmt.Println(fmt.Sprintf("svcat instance '%s' is marked for deletion, deleting it from operator", pair.svcatInstance.Name))
-		err = m.SapOperatorRestClient.Delete().Name(res.Name).Namespace(res.Namespace).Do(ctx).Error()
+		fmt.Fprintln(output, fmt.Sprintf("svcat instance '%s' is marked for deletion, deleting it from operator", pair.svcatInstance.Name))
+		err := m.SapOperatorRestClient.Delete().Name(res.Name).Namespace(res.Namespace).Do(ctx).Error()
 		if err != nil {
-			fmt.Println(fmt.Sprintf("failed to delete instance from operator: %v", err.Error()))
+			fmt.Fprintln(output, fmt.Sprintf("failed to delete instance from operator: %v", err.Error()))
 		}
 	}
 
 	pair.svcatInstance.Finalizers = []string{}
-	err = m.SvcatRestClient.Put().Name(pair.svcatInstance.Name).Namespace(pair.svcatInstance.Namespace).Resource(ServiceInstances).Body(pair.svcatInstance).Do(ctx).Error()
+	err := m.SvcatRestClient.Put().Name(pair.svcatInstance.Name).Namespace(pair.svcatInstance.Namespace).Resource(ServiceInstances).Body(pair.svcatInstance).Do(ctx).Error()
 	if err != nil {
 		return fmt.Errorf("failed to delete finalizer from instance '%s'. Error: %v", pair.svcatInstance.Name, err.Error())
 	}
 
-	err = m.deleteSvcatResource(ctx, res.Name, res.Namespace, ServiceInstances)
+	err = m.deleteSvcatResource(ctx, res.Name, pair.svcatInstance.Name, res.Namespace, ServiceInstances)
 	if err != nil {
-		fmt.Println(fmt.Sprintf("failed to delete svcat resource. Error: %v", err.Error()))
+		fmt.Fprintln(output, fmt.Sprintf("failed to delete svcat resource. Error: %v", err.Error()))
+	}
+
+	//the instance is expected to be deleted if svcat instance was marked for deletion
+	if pair.svcatInstance.DeletionTimestamp.IsZero() {
+		return m.verifyInstanceSurvived(ctx, pair)
 	}
-	fmt.Println("instance migrated successfully")
 	return nil
 }
 
 func (m *Migrator) migrateBinding(ctx context.Context, pair serviceBindingPair) error {
 
-	fmt.Println(fmt.Sprintf("migrating service binding '%s' in namespace '%s' (smID: '%s')", pair.svcatBinding.Name, pair.svcatBinding.Namespace, pair.svcatBinding.Spec.ExternalID))
-	secretExists := true
-	secret, err := m.ClientSet.CoreV1().Secrets(pair.svcatBinding.Namespace).Get(ctx, pair.svcatBinding.Spec.SecretName, metav1.GetOptions{})
+	fmt.Fprintln(output, fmt.Sprintf("migrating service binding '%s' in namespace '%s' (smID: '%s')", pair.svcatBinding.Name, pair.svcatBinding.Namespace, pair.svcatBinding.Spec.ExternalID))
+	secret, err := m.getBindingSecret(ctx, pair)
 	if err != nil {
-		if errors.IsNotFound(err) {
-			fmt.Println(fmt.Sprintf("Info: secret named '%s' not found for binding", pair.svcatBinding.Spec.SecretName))
-			secretExists = false
-		} else {
-			return fmt.Errorf("failed to get binding's secret, skipping binding migration. Error: %v", err.Error())
+		return err
+	}
+	recreated := false
+	if secret == nil && m.RecreateMissingSecrets {
+		secret, err = m.recreateBindingSecret(ctx, pair)
+		if err != nil {
+			return err
 		}
+		recreated = true
 	}
-	//add k8sname label and save credentials
-	requestBody, err := m.getMigrateBindingRequestBody(pair.svcatBinding.Name, secret)
+
+	res, err := m.getOperatorBinding(ctx, pair.svcatBinding.Namespace, pair.targetName)
 	if err != nil {
-		return fmt.Errorf("failed to build request body for migrating instance. Error: %v", err.Error())
+		return fmt.Errorf("failed to get operator binding '%s'. Error: %v", pair.targetName, err.Error())
 	}
-	buffer := bytes.NewBuffer([]byte(requestBody))
-	response, err := m.SMClient.Call(http.MethodPut, fmt.Sprintf("/v1/migrate/service_bindings/%s", pair.smBinding.ID), buffer, &sm.Parameters{})
-	if err != nil || response.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to add k8s label to service binding name: %s, ID: %s", pair.smBinding.Name, pair.smBinding.ID)
+	alreadyMigrated := res != nil && isMigratedBinding(res, pair.smBinding.ID)
+	var binding *v1alpha1.ServiceBinding
+	if alreadyMigrated {
+		fmt.Fprintln(output, "binding was already migrated by a previous run, continuing with the remaining steps")
+	} else {
+		binding, err = m.getBindingStruct(pair)
+		if err != nil {
+			return err
+		}
+		if secret != nil && !recreated {
+			secret, err = m.reconcileBindingCredentials(ctx, pair, secret)
+			if err != nil {
+				return err
+			}
+		}
+		//add k8sname label and save credentials
+		requestBody, err := m.getMigrateBindingRequestBody(pair.targetName, secret)
+		if err != nil {
+			return fmt.Errorf("failed to build request body for migrating instance. Error: %v", err.Error())
+		}
+		err = callMigrateAPI(pair.subaccount.smClient, fmt.Sprintf("/v1/migrate/service_bindings/%s", pair.smBinding.ID), requestBody)
+		if err != nil {
+			return fmt.Errorf("failed to add k8s label to service binding name: %s, ID: %s. Error: %w", pair.smBinding.Name, pair.smBinding.ID, err)
+		}
 	}
 
-	if secretExists {
-		//add 'binding' label to secret
-		if secret.Labels == nil {
-			secret.Labels = make(map[string]string, 1)
-		}
-		secret.Labels["binding"] = pair.svcatBinding.Name
-		secret, err = m.ClientSet.CoreV1().Secrets(secret.Namespace).Update(ctx, secret, metav1.UpdateOptions{})
+	secret, err = m.labelBindingSecret(ctx, pair, secret)
+	if err != nil {
+		return err
+	}
+
+	if !alreadyMigrated {
+		res, err = m.createOperatorBinding(ctx, binding)
 		if err != nil {
-			return fmt.Errorf("failed to add label to binding. Error: %v", err.Error())
+			return err
+		}
+	}
+
+	err = m.completeBindingMigration(ctx, pair, secret, res)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(output, "binding migrated successfully")
+	return nil
+}
+
+// getBindingSecret returns the secret of the svcat binding, or nil if it does not exist
+func (m *Migrator) getBindingSecret(ctx context.Context, pair serviceBindingPair) (*corev1.Secret, error) {
+	secret, err := m.ClientSet.CoreV1().Secrets(pair.svcatBinding.Namespace).Get(ctx, pair.svcatBinding.Spec.SecretName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			fmt.Fprintln(output, fmt.Sprintf("Info: secret named '%s' not found for binding", pair.svcatBinding.Spec.SecretName))
+			return nil, nil
 		}
+		return nil, fmt.Errorf("failed to get binding's secret, skipping binding migration. Error: %v", err.Error())
 	}
+	redact.RegisterBytes(secret.Data)
+	return secret, nil
+}
 
-	binding := m.getBindingStruct(pair)
+func (m *Migrator) labelBindingSecret(ctx context.Context, pair serviceBindingPair, secret *corev1.Secret) (*corev1.Secret, error) {
+	if secret == nil {
+		return nil, nil
+	}
+	//add 'binding' label to secret
+	if secret.Labels == nil {
+		secret.Labels = make(map[string]string, 1)
+	}
+	secret.Labels["binding"] = pair.targetName
+	secret, err := m.ClientSet.CoreV1().Secrets(secret.Namespace).Update(ctx, secret, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add label to binding. Error: %v", err.Error())
+	}
+	return secret, nil
+}
+
+func (m *Migrator) createOperatorBinding(ctx context.Context, binding *v1alpha1.ServiceBinding) (*v1alpha1.ServiceBinding, error) {
 	res := &v1alpha1.ServiceBinding{}
-	err = m.SapOperatorRestClient.Post().
+	err := m.SapOperatorRestClient.Post().
 		Namespace(binding.Namespace).
 		Resource(ServiceBindings).
 		Body(binding).
 		Do(ctx).
 		Into(res)
 	if err != nil {
-		return fmt.Errorf("failed to create service binding: %v", err.Error())
-	}
-
-	if secretExists {
-		//set the new binding as owner reference for the secret
-		t := true
-		owner := metav1.OwnerReference{
-			APIVersion:         res.APIVersion,
-			Kind:               res.Kind,
-			Name:               res.Name,
-			UID:                res.UID,
-			Controller:         &t,
-			BlockOwnerDeletion: &t,
-		}
-		secret.OwnerReferences = []metav1.OwnerReference{owner}
-		secret, err = m.ClientSet.CoreV1().Secrets(secret.Namespace).Update(ctx, secret, metav1.UpdateOptions{})
+		return nil, fmt.Errorf("failed to create service binding: %v", err.Error())
+	}
+	return res, nil
+}
+
+// completeBindingMigration performs the steps following the creation of the operator binding
+func (m *Migrator) completeBindingMigration(ctx context.Context, pair serviceBindingPair, secret *corev1.Secret, res *v1alpha1.ServiceBinding) error {
+	if secret != nil {
+		err := m.setSecretOwner(ctx, secret, res)
 		if err != nil {
-			return fmt.Errorf("failed to set new binding as owner of secret. Error: %v", err.Error())
+			return err
 		}
 	}
 
 	if !pair.svcatBinding.DeletionTimestamp.IsZero() {
-		fmt.Println(fmt.Sprintf("svcat binding '%s' is marked for deletion, deleting it from operator", pair.svcatBinding.Name))
-		err = m.SapOperatorRestClient.Delete().Name(res.Name).Namespace(res.Namespace).Do(ctx).Error()
+		fmt.Fprintln(output, fmt.Sprintf("svcat binding '%s' is marked for deletion, deleting it from operator", pair.svcatBinding.Name))
+		err := m.SapOperatorRestClient.Delete().Name(res.Name).Namespace(res.Namespace).Do(ctx).Error()
 		if err != nil {
-			fmt.Println(fmt.Sprintf("failed to delete binding from operator. Error: %v", err.Error()))
+			fmt.Fprintln(output, fmt.Sprintf("failed to delete binding from operator. Error: %v", err.Error()))
 		}
 	}
 
 	//remove finalizer from binding to avoid deletion of the secret
 	pair.svcatBinding.Finalizers = []string{}
-	err = m.SvcatRestClient.Put().Name(pair.svcatBinding.Name).Namespace(pair.svcatBinding.Namespace).Resource(ServiceBindings).Body(pair.svcatBinding).Do(ctx).Error()
+	err := m.SvcatRestClient.Put().Name(pair.svcatBinding.Name).Namespace(pair.svcatBinding.Namespace).Resource(ServiceBindings).Body(pair.svcatBinding).Do(ctx).Error()
 	if err != nil {
 		return fmt.Errorf("failed to delete finalizer from binding '%s'. Error: %v", pair.svcatBinding.Name, err.Error())
 	}
 
-	err = m.deleteSvcatResource(ctx, res.Name, res.Namespace, ServiceBindings)
+	err = m.deleteSvcatResource(ctx, res.Name, pair.svcatBinding.Name, res.Namespace, ServiceBindings)
 	if err != nil {
 		return fmt.Errorf("failed to delete svcat binding. Error: %v", err.Error())
 	}
-	fmt.Println("binding migrated successfully")
+
+	//the binding is expected to be deleted if svcat binding was marked for deletion
+	if pair.svcatBinding.DeletionTimestamp.IsZero() {
+		return m.verifyBindingSurvived(ctx, pair)
+	}
+	return nil
+}
+
+// setSecretOwner sets the operator binding as the owner reference of the secret
+func (m *Migrator) setSecretOwner(ctx context.Context, secret *corev1.Secret, res *v1alpha1.ServiceBinding) error {
+	t := true
+	owner := metav1.OwnerReference{
+		APIVersion:         res.APIVersion,
+		Kind:               res.Kind,
+		Name:               res.Name,
+		UID:                res.UID,
+		Controller:         &t,
+		BlockOwnerDeletion: &t,
+	}
+	secret.OwnerReferences = []metav1.OwnerReference{owner}
+	_, err := m.ClientSet.CoreV1().Secrets(secret.Namespace).Update(ctx, secret, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to set new binding as owner of secret. Error: %v", err.Error())
+	}
 	return nil
 }
 
-func (m *Migrator) deleteSvcatResource(ctx context.Context, resourceName string, resourceNamespace string, resourceType string) error {
+func (m *Migrator) deleteSvcatResource(ctx context.Context, operatorName string, svcatName string, resourceNamespace string, resourceType string) error {
 
-	err := m.SapOperatorRestClient.Get().Name(resourceName).Namespace(resourceNamespace).Resource(resourceType).Do(ctx).Error()
+	err := m.SapOperatorRestClient.Get().Name(operatorName).Namespace(resourceNamespace).Resource(resourceType).Do(ctx).Error()
 	if err != nil {
-		fmt.Println(fmt.Sprintf("failed to get the migrated service instance '%s' status, corresponding svcat resource will not be deleted. Error: %v",
-			resourceName, err.Error()))
+		fmt.Fprintln(output, fmt.Sprintf("failed to get the migrated service instance '%s' status, corresponding svcat resource will not be deleted. Error: %v",
+			operatorName, err.Error()))
 		return err
 	}
 
-	//fmt.Println(fmt.Sprintf("deleting svcat resource type '%s' named '%s' in namespace '%s'", resourceType, resourceName, resourceNamespace))
-	err = m.SvcatRestClient.Delete().Name(resourceName).Namespace(resourceNamespace).Resource(resourceType).Do(ctx).Error()
+	//fmt.Fprintln(output, fmt.Sprintf("deleting svcat resource type '%s' named '%s' in namespace '%s'", resourceType, svcatName, resourceNamespace))
+	err = m.SvcatRestClient.Delete().Name(svcatName).Namespace(resourceNamespace).Resource(resourceType).Do(ctx).Error()
 	return err
 }
 
+// getOperatorInstance returns the operator instance with the given name, or nil if it does not exist
+func (m *Migrator) getOperatorInstance(ctx context.Context, namespace, name string) (*v1alpha1.ServiceInstance, error) {
+	instance := &v1alpha1.ServiceInstance{}
+	err := m.SapOperatorRestClient.Get().Namespace(namespace).Resource(ServiceInstances).Name(name).Do(ctx).Into(instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return instance, nil
+}
+
+// getOperatorBinding returns the operator binding with the given name, or nil if it does not exist
+func (m *Migrator) getOperatorBinding(ctx context.Context, namespace, name string) (*v1alpha1.ServiceBinding, error) {
+	binding := &v1alpha1.ServiceBinding{}
+	err := m.SapOperatorRestClient.Get().Namespace(namespace).Resource(ServiceBindings).Name(name).Do(ctx).Into(binding)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return binding, nil
+}
+
+// isMigratedInstance returns true if the operator instance was created by a previous migration of the given SM instance.
+// The SM ID annotation identifies it even before the operator reconciled it, the status covers instances migrated without it.
+func isMigratedInstance(instance *v1alpha1.ServiceInstance, smID string) bool {
+	return instance.Labels["migrated"] == "true" && (instance.Annotations[smIDAnnotation] == smID || instance.Status.InstanceID == smID)
+}
+
+// isMigratedBinding returns true if the operator binding was created by a previous migration of the given SM binding.
+// The SM ID annotation identifies it even before the operator reconciled it, the status covers bindings migrated without it.
+func isMigratedBinding(binding *v1alpha1.ServiceBinding, smID string) bool {
+	return binding.Labels["migrated"] == "true" && (binding.Annotations[smIDAnnotation] == smID || binding.Status.BindingID == smID)
+}
+
 func (m *Migrator) getMigrateBindingRequestBody(k8sName string, secret *corev1.Secret) (string, error) {
 	var err error
 	secretData := []byte("")
@@ -420,68 +843,53 @@ func (m *Migrator) getMigrateBindingRequestBody(k8sName string, secret *corev1.S
 		}`, k8sName, secretData), nil
 }
 
-func (m *Migrator) validate(ctx context.Context, instancesToMigrate []serviceInstancePair, bindingsToMigrate []serviceBindingPair) (int, bytes.Buffer) {
+// validate runs the migration of the resources in dry-run mode, it returns early if runCtx is done
+func (m *Migrator) validate(ctx context.Context, runCtx context.Context, instancesToMigrate []serviceInstancePair, bindingsToMigrate []serviceBindingPair) (int, bytes.Buffer) {
 	var buffer bytes.Buffer
 	count := 0
 	for _, pair := range instancesToMigrate {
+		if runCtx.Err() != nil {
+			return count, buffer
+		}
+		printCompatibilityFindings("instance", pair.svcatInstance.Name, pair.svcatInstance.Namespace, getInstanceCompatibilityFindings(pair.svcatInstance))
 		err := m.migrateInstanceDryRun(ctx, pair)
 		if err != nil {
 			count++
 			buffer.WriteString(fmt.Sprintf("instance '%s' in namespace '%s' failed: '%v' \n", pair.svcatInstance.Name, pair.svcatInstance.Namespace, err.Error()))
 		} else {
-			fmt.Println(fmt.Sprintf("svcat instance '%s' in namespace '%s' was validated successfully", pair.svcatInstance.Name, pair.svcatInstance.Namespace))
+			fmt.Fprintln(output, fmt.Sprintf("svcat instance '%s' in namespace '%s' was validated successfully", pair.svcatInstance.Name, pair.svcatInstance.Namespace))
 		}
 	}
 
 	for _, pair := range bindingsToMigrate {
+		if runCtx.Err() != nil {
+			return count, buffer
+		}
 		err := m.migrateBindingDryRun(ctx, pair)
 		if err != nil {
 			count++
 			buffer.WriteString(fmt.Sprintf("binding '%s' in namespace '%s' failed: '%v' \n", pair.svcatBinding.Name, pair.svcatBinding.Namespace, err.Error()))
 		} else {
-			fmt.Println(fmt.Sprintf("svcat binding '%s' in namespace '%s' was validated successfully", pair.svcatBinding.Name, pair.svcatBinding.Namespace))
+			fmt.Fprintln(output, fmt.Sprintf("svcat binding '%s' in namespace '%s' was validated successfully", pair.svcatBinding.Name, pair.svcatBinding.Namespace))
 		}
 	}
 	return count, buffer
 }
 
-func getPlans(smclient sm.Client) map[string]types.ServicePlan {
-	plans, err := smclient.ListPlans(nil)
-	cobra.CheckErr(err)
-	res := make(map[string]types.ServicePlan)
-	for _, plan := range plans.ServicePlans {
-		res[plan.ID] = plan
+func (m *Migrator) getInstanceStruct(pair serviceInstancePair) (*v1alpha1.ServiceInstance, error) {
+	plan, service, err := m.resolvePlan(pair)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map instance '%s': %v", pair.svcatInstance.Name, err.Error())
 	}
-	return res
-}
 
-func getServices(smclient sm.Client) map[string]types.ServiceOffering {
-	services, err := smclient.ListOfferings(nil)
-	cobra.CheckErr(err)
-	res := make(map[string]types.ServiceOffering)
-	for _, svc := range services.ServiceOfferings {
-		res[svc.ID] = svc
-	}
-	return res
-}
-
-func (m *Migrator) getInstanceStruct(pair serviceInstancePair) *v1alpha1.ServiceInstance {
-	plan := m.Plans[pair.smInstance.ServicePlanID]
-	service := m.Services[plan.ServiceOfferingID]
-
-	parametersFrom := make([]v1alpha1.ParametersFromSource, 0)
-	for _, param := range pair.svcatInstance.Spec.ParametersFrom {
-		parametersFrom = append(parametersFrom, v1alpha1.ParametersFromSource{
-			SecretKeyRef: &v1alpha1.SecretKeyReference{
-				Name: param.SecretKeyRef.Name,
-				Key:  param.SecretKeyRef.Key,
-			},
-		})
+	parametersFrom, err := getParametersFrom(pair.svcatInstance.Spec.ParametersFrom)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map instance '%s': %v", pair.svcatInstance.Name, err.Error())
 	}
 
 	userInfo, err := json.Marshal(pair.svcatInstance.Spec.UserInfo)
 	if err != nil {
-		fmt.Println(fmt.Sprintf("failed to parse user info for instance %s: %v", pair.svcatInstance.Name, err.Error()))
+		fmt.Fprintln(output, fmt.Sprintf("failed to parse user info for instance %s: %v", pair.svcatInstance.Name, err.Error()))
 	}
 
 	return &v1alpha1.ServiceInstance{
@@ -490,39 +898,36 @@ func (m *Migrator) getInstanceStruct(pair serviceInstancePair) *v1alpha1.Service
 			Kind:       "ServiceInstance",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      pair.svcatInstance.Name,
+			Name:      pair.targetName,
 			Namespace: pair.svcatInstance.Namespace,
 			Labels: map[string]string{
 				"migrated": "true",
 			},
 			Annotations: map[string]string{
 				"original_creation_timestamp": pair.svcatInstance.CreationTimestamp.String(),
-				"original_user_info":          string(userInfo)},
+				"original_user_info":          string(userInfo),
+				smIDAnnotation:                pair.smInstance.ID},
 		},
 		Spec: v1alpha1.ServiceInstanceSpec{
 			ServicePlanName:     plan.Name,
 			ServiceOfferingName: service.Name,
+			ServicePlanID:       plan.ID,
 			ExternalName:        pair.smInstance.Name,
 			ParametersFrom:      parametersFrom,
 			Parameters:          pair.svcatInstance.Spec.Parameters,
 		},
-	}
+	}, nil
 }
 
-func (m *Migrator) getBindingStruct(pair serviceBindingPair) *v1alpha1.ServiceBinding {
-	parametersFrom := make([]v1alpha1.ParametersFromSource, 0)
-	for _, param := range pair.svcatBinding.Spec.ParametersFrom {
-		parametersFrom = append(parametersFrom, v1alpha1.ParametersFromSource{
-			SecretKeyRef: &v1alpha1.SecretKeyReference{
-				Name: param.SecretKeyRef.Name,
-				Key:  param.SecretKeyRef.Key,
-			},
-		})
+func (m *Migrator) getBindingStruct(pair serviceBindingPair) (*v1alpha1.ServiceBinding, error) {
+	parametersFrom, err := getParametersFrom(pair.svcatBinding.Spec.ParametersFrom)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map binding '%s': %v", pair.svcatBinding.Name, err.Error())
 	}
 
 	userInfo, err := json.Marshal(pair.svcatBinding.Spec.UserInfo)
 	if err != nil {
-		fmt.Println(fmt.Sprintf("failed to parse user info for binding %s. Error: %v", pair.svcatBinding.Name, err.Error()))
+		fmt.Fprintln(output, fmt.Sprintf("failed to parse user info for binding %s. Error: %v", pair.svcatBinding.Name, err.Error()))
 	}
 
 	return &v1alpha1.ServiceBinding{
@@ -531,20 +936,22 @@ func (m *Migrator) getBindingStruct(pair serviceBindingPair) *v1alpha1.ServiceBi
 			Kind:       "ServiceBinding",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      pair.svcatBinding.Name,
+			Name:      pair.targetName,
 			Namespace: pair.svcatBinding.Namespace,
 			Labels: map[string]string{
 				"migrated": "true",
 			},
 			Annotations: map[string]string{
 				"original_creation_timestamp": pair.svcatBinding.CreationTimestamp.String(),
-				"original_user_info":          string(userInfo)},
+				"original_user_info":          string(userInfo),
+				smIDAnnotation:                pair.smBinding.ID},
 		},
 		Spec: v1alpha1.ServiceBindingSpec{
-			ServiceInstanceName: pair.svcatBinding.Spec.InstanceRef.Name,
+			ServiceInstanceName: pair.instanceTargetName,
 			ExternalName:        pair.smBinding.Name,
+			SecretName:          getOperatorSecretName(pair),
 			ParametersFrom:      parametersFrom,
 			Parameters:          pair.svcatBinding.Spec.Parameters,
 		},
-	}
+	}, nil
 }
@@ -0,0 +1,83 @@
+package migrate
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/SAP/sap-btp-service-operator/client/sm/types"
+	"github.com/kubernetes-sigs/service-catalog/pkg/apis/servicecatalog/v1beta1"
+)
+
+const benchmarkBindingCount = 10000
+
+// newBindingsBenchmarkFixture returns a migrator whose SM bindings match the returned svcat bindings one to one
+func newBindingsBenchmarkFixture() (*Migrator, v1beta1.ServiceBindingList) {
+	smBindings := make([]types.ServiceBinding, benchmarkBindingCount)
+	svcatBindings := v1beta1.ServiceBindingList{Items: make([]v1beta1.ServiceBinding, benchmarkBindingCount)}
+	for i := 0; i < benchmarkBindingCount; i++ {
+		id := fmt.Sprintf("binding-%d", i)
+		smBindings[i] = types.ServiceBinding{ID: id, Name: id}
+		svcat := &svcatBindings.Items[i]
+		svcat.Name = id
+		svcat.Namespace = fmt.Sprintf("namespace-%d", i%100)
+		svcat.Spec.ExternalID = id
+		svcat.Spec.InstanceRef.Name = fmt.Sprintf("instance-%d", i)
+	}
+	m := &Migrator{
+		defaultSubaccount: &subaccount{
+			smInstances: &types.ServiceInstances{},
+			smBindings:  &types.ServiceBindings{ServiceBindings: smBindings},
+		},
+	}
+	return m, svcatBindings
+}
+
+func BenchmarkGetBindingsToMigrate(b *testing.B) {
+	m, svcatBindings := newBindingsBenchmarkFixture()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.defaultSubaccount.indexSMResources()
+		if pairs := m.getBindingsToMigrate(svcatBindings); len(pairs) != benchmarkBindingCount {
+			b.Fatalf("expected %d bindings to migrate, got %d", benchmarkBindingCount, len(pairs))
+		}
+	}
+}
+
+// BenchmarkGetBindingsToMigrateByScan measures the previous matching, which scanned the SM bindings for each svcat binding
+func BenchmarkGetBindingsToMigrateByScan(b *testing.B) {
+	m, svcatBindings := newBindingsBenchmarkFixture()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if pairs := getBindingsToMigrateByScan(m, svcatBindings); len(pairs) != benchmarkBindingCount {
+			b.Fatalf("expected %d bindings to migrate, got %d", benchmarkBindingCount, len(pairs))
+		}
+	}
+}
+
+func getBindingsToMigrateByScan(m *Migrator, svcatBindings v1beta1.ServiceBindingList) []serviceBindingPair {
+	validBindings := make([]serviceBindingPair, 0)
+	for _, svcat := range svcatBindings.Items {
+		subaccount := m.getSubaccount(svcat.Namespace)
+		var smBinding *types.ServiceBinding
+		for _, binding := range subaccount.smBindings.ServiceBindings {
+			if binding.ID == svcat.Spec.ExternalID {
+				smBinding = &binding
+				break
+			}
+		}
+		if smBinding == nil {
+			continue
+		}
+		svcBinding := svcat
+		validBindings = append(validBindings, serviceBindingPair{
+			svcatBinding:       &svcBinding,
+			smBinding:          smBinding,
+			subaccount:         subaccount,
+			targetName:         svcBinding.Name,
+			instanceTargetName: svcBinding.Spec.InstanceRef.Name,
+		})
+	}
+	return validBindings
+}
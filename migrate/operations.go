@@ -0,0 +1,150 @@
+package migrate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	smTypes "github.com/Peripli/service-manager/pkg/types"
+	"github.com/SAP/sap-btp-service-operator/client/sm"
+	"github.com/SAP/sap-btp-service-operator/client/sm/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	operationPollInterval = 5 * time.Second
+	operationTimeout      = 5 * time.Minute
+
+	// maxErrorBodySize limits how much of an SM error response is read
+	maxErrorBodySize = 64 * 1024
+)
+
+var correlationIDHeaders = []string{"X-Correlation-ID", "X-Vcap-Request-Id"}
+
+// SMError is a failed SM migrate call, with the SM error details and the correlation ID to look the request up in SM
+type SMError struct {
+	StatusCode    int
+	ErrorType     string
+	Description   string
+	CorrelationID string
+}
+
+func (e *SMError) Error() string {
+	message := "SM request failed"
+	if e.StatusCode != 0 {
+		message = fmt.Sprintf("SM returned status code %d", e.StatusCode)
+	}
+	switch {
+	case e.ErrorType != "" && e.Description != "":
+		message += fmt.Sprintf(": %s: %s", e.ErrorType, e.Description)
+	case e.ErrorType != "" || e.Description != "":
+		message += fmt.Sprintf(": %s%s", e.ErrorType, e.Description)
+	}
+	if e.CorrelationID != "" {
+		message += fmt.Sprintf(" (correlation ID: %s)", e.CorrelationID)
+	}
+	return message
+}
+
+// newSMError parses the body of a failed SM response, SM errors are JSON objects with an error type and a description
+func newSMError(response *http.Response) *SMError {
+	smErr := &SMError{StatusCode: response.StatusCode, CorrelationID: getCorrelationID(response)}
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, maxErrorBodySize))
+	if err == nil {
+		parseSMErrorBody(smErr, body)
+	}
+	return smErr
+}
+
+func getCorrelationID(response *http.Response) string {
+	for _, header := range correlationIDHeaders {
+		if correlationID := response.Header.Get(header); correlationID != "" {
+			return correlationID
+		}
+	}
+	return ""
+}
+
+func parseSMErrorBody(smErr *SMError, body []byte) {
+	details := struct {
+		Error       string `json:"error"`
+		Description string `json:"description"`
+	}{}
+	if err := json.Unmarshal(body, &details); err == nil {
+		smErr.ErrorType = details.Error
+		smErr.Description = details.Description
+	} else {
+		smErr.Description = strings.TrimSpace(string(body))
+	}
+}
+
+// callMigrateAPI sends a PUT to an SM migrate endpoint. When SM accepts the request asynchronously,
+// it follows the operation location and waits for the operation to complete.
+func callMigrateAPI(smClient sm.Client, path string, body string) error {
+	response, err := smClient.Call(http.MethodPut, path, bytes.NewBufferString(body), &sm.Parameters{})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, response.Body)
+		response.Body.Close()
+	}()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusAccepted:
+		location := response.Header.Get("Location")
+		if location == "" {
+			return fmt.Errorf("SM accepted the request without an operation location")
+		}
+		return waitForOperation(smClient, location, getCorrelationID(response))
+	}
+	return newSMError(response)
+}
+
+// waitForOperation polls the SM operation until it succeeds, fails or does not complete in time
+func waitForOperation(smClient sm.Client, location string, correlationID string) error {
+	// the operation location is relative to the SM URL, keep only the path if SM returns an absolute one
+	if parsed, err := url.Parse(location); err == nil && parsed.IsAbs() {
+		location = parsed.Path
+	}
+
+	var operation *types.Operation
+	err := wait.PollImmediate(operationPollInterval, operationTimeout, func() (bool, error) {
+		var err error
+		operation, err = smClient.Status(location, &sm.Parameters{})
+		if err != nil {
+			return false, fmt.Errorf("failed to get status of operation '%s': %v", location, err.Error())
+		}
+		switch strings.ToLower(operation.State) {
+		case string(smTypes.SUCCEEDED):
+			return true, nil
+		case string(smTypes.FAILED):
+			return false, getOperationError(operation, correlationID)
+		}
+		return false, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("operation '%s' did not complete within %s, last state '%s'", location, operationTimeout, operation.State)
+	}
+	return err
+}
+
+// getOperationError returns the errors of a failed SM operation, with the correlation ID of the request that started it
+func getOperationError(operation *types.Operation, correlationID string) *SMError {
+	smErr := &SMError{CorrelationID: correlationID}
+	if len(operation.Errors) > 0 && string(operation.Errors) != "null" {
+		parseSMErrorBody(smErr, operation.Errors)
+	}
+	if smErr.ErrorType == "" && smErr.Description == "" {
+		smErr.Description = fmt.Sprintf("operation '%s' failed: %s", operation.ID, operation.Description)
+	}
+	return smErr
+}
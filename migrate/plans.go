@@ -0,0 +1,92 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/SAP/sap-btp-service-operator/client/sm/types"
+	"github.com/kubernetes-sigs/service-catalog/pkg/apis/servicecatalog/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+const ClusterServicePlans = "clusterserviceplans"
+const ServicePlans = "serviceplans"
+
+// resolvePlan returns the SM plan and offering of the instance
+func (m *Migrator) resolvePlan(pair serviceInstancePair) (types.ServicePlan, types.ServiceOffering, error) {
+	plan, ok := pair.subaccount.plans[pair.smInstance.ServicePlanID]
+	if !ok {
+		return types.ServicePlan{}, types.ServiceOffering{}, fmt.Errorf("plan '%s' of SM instance '%s' was not found in SM", pair.smInstance.ServicePlanID, pair.smInstance.ID)
+	}
+	service, ok := pair.subaccount.services[plan.ServiceOfferingID]
+	if !ok {
+		return types.ServicePlan{}, types.ServiceOffering{}, fmt.Errorf("offering '%s' of plan '%s' was not found in SM", plan.ServiceOfferingID, plan.Name)
+	}
+	return plan, service, nil
+}
+
+// validatePlan cross-checks the SM plan and offering of the instance with the plan and class the svcat instance references
+func (m *Migrator) validatePlan(ctx context.Context, pair serviceInstancePair) error {
+	plan, service, err := m.resolvePlan(pair)
+	if err != nil {
+		return err
+	}
+
+	var mismatches []string
+	check := func(field, svcatValue, smValue string) {
+		if svcatValue != "" && svcatValue != smValue {
+			mismatches = append(mismatches, fmt.Sprintf("%s '%s' does not match '%s'", field, svcatValue, smValue))
+		}
+	}
+	spec := pair.svcatInstance.Spec
+	check("clusterServiceClassExternalName", spec.ClusterServiceClassExternalName, service.CatalogName)
+	check("clusterServiceClassExternalID", spec.ClusterServiceClassExternalID, service.CatalogID)
+	check("clusterServicePlanExternalName", spec.ClusterServicePlanExternalName, plan.CatalogName)
+	check("clusterServicePlanExternalID", spec.ClusterServicePlanExternalID, plan.CatalogID)
+	check("serviceClassExternalName", spec.ServiceClassExternalName, service.CatalogName)
+	check("serviceClassExternalID", spec.ServiceClassExternalID, service.CatalogID)
+	check("servicePlanExternalName", spec.ServicePlanExternalName, plan.CatalogName)
+	check("servicePlanExternalID", spec.ServicePlanExternalID, plan.CatalogID)
+
+	svcatPlan, err := m.getSvcatPlan(ctx, pair.svcatInstance)
+	if err != nil {
+		return err
+	}
+	if svcatPlan != nil {
+		check("svcat plan externalName", svcatPlan.ExternalName, plan.CatalogName)
+		check("svcat plan externalID", svcatPlan.ExternalID, plan.CatalogID)
+	}
+
+	if len(mismatches) > 0 {
+		return fmt.Errorf("svcat plan does not match SM plan '%s' of offering '%s': %s", plan.Name, service.Name, strings.Join(mismatches, ", "))
+	}
+	return nil
+}
+
+// getSvcatPlan returns the spec of the svcat plan the instance references, or nil if it references none or the plan no longer exists
+func (m *Migrator) getSvcatPlan(ctx context.Context, instance *v1beta1.ServiceInstance) (*v1beta1.CommonServicePlanSpec, error) {
+	switch {
+	case instance.Spec.ClusterServicePlanRef != nil:
+		plan := &v1beta1.ClusterServicePlan{}
+		err := m.SvcatRestClient.Get().Resource(ClusterServicePlans).Name(instance.Spec.ClusterServicePlanRef.Name).Do(ctx).Into(plan)
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get svcat cluster service plan '%s': %v", instance.Spec.ClusterServicePlanRef.Name, err.Error())
+		}
+		return &plan.Spec.CommonServicePlanSpec, nil
+	case instance.Spec.ServicePlanRef != nil:
+		plan := &v1beta1.ServicePlan{}
+		err := m.SvcatRestClient.Get().Namespace(instance.Namespace).Resource(ServicePlans).Name(instance.Spec.ServicePlanRef.Name).Do(ctx).Into(plan)
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get svcat service plan '%s': %v", instance.Spec.ServicePlanRef.Name, err.Error())
+		}
+		return &plan.Spec.CommonServicePlanSpec, nil
+	}
+	return nil, nil
+}
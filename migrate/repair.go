@@ -0,0 +1,331 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	smTypes "github.com/Peripli/service-manager/pkg/types"
+	"github.com/SAP/sap-btp-service-operator/client/sm/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// k8sNameLabel is the SM label holding the name of the k8s resource, it is set by the SM migrate API
+const k8sNameLabel = "_k8sname"
+
+// Repair detects resources left in between states by an interrupted migration and completes their migration:
+// svcat resources that were already handed over in SM (k8sname set) get their operator resource created if missing,
+// their finalizers removed and are deleted, and labeled binding secrets are set with their operator binding as owner.
+// When runCtx is cancelled or its deadline passes, the resource in progress is completed and the repair stops.
+func (m *Migrator) Repair(runCtx context.Context) {
+	ctx := context.Background()
+	defer m.RunCleanups()
+	defer m.smRetries.print()
+	if err := m.acquireLock(ctx); err != nil {
+		fmt.Fprintln(output, err.Error())
+		return
+	}
+
+	instances, bindings := m.getResourcesToMigrate(ctx)
+	if isStopped(runCtx) {
+		return
+	}
+
+	if m.ScaleDownSvcatController {
+		if err := m.scaleDownSvcatController(ctx); err != nil {
+			fmt.Fprintln(output, err.Error())
+			return
+		}
+	}
+
+	var failuresBuffer bytes.Buffer
+	repaired := 0
+	defer func() {
+		fmt.Fprintln(output, fmt.Sprintf("*** Repaired %d resources", repaired))
+		if failuresBuffer.Len() > 0 {
+			fmt.Fprintln(output, "*** Repair failures summary:")
+			fmt.Fprintln(output, failuresBuffer.String())
+		}
+	}()
+
+	fmt.Fprintln(output, "*** Repairing instances")
+	var rechecks []func() error
+	for _, pair := range instances {
+		if isStopped(runCtx) {
+			return
+		}
+		k8sName := getK8sName(pair.smInstance.Labels)
+		if k8sName == "" {
+			continue
+		}
+		pair.targetName = k8sName
+		err := m.repairInstance(ctx, pair)
+		if isDeprovisionTriggered(err) {
+			return
+		}
+		if err != nil {
+			fmt.Fprintln(output, err.Error())
+			failuresBuffer.WriteString(err.Error() + "\n")
+			continue
+		}
+		repaired++
+		if pair.svcatInstance.DeletionTimestamp.IsZero() {
+			pair := pair
+			rechecks = append(rechecks, func() error { return checkInstanceSurvived(pair) })
+		}
+	}
+	for _, err := range m.recheckSurvived(rechecks) {
+		if isDeprovisionTriggered(err) {
+			return
+		}
+		fmt.Fprintln(output, err.Error())
+		failuresBuffer.WriteString(err.Error() + "\n")
+	}
+
+	fmt.Fprintln(output, "*** Repairing bindings")
+	rechecks = nil
+	for _, pair := range bindings {
+		if isStopped(runCtx) {
+			return
+		}
+		k8sName := getK8sName(pair.smBinding.Labels)
+		if k8sName == "" {
+			continue
+		}
+		pair.targetName = k8sName
+		err := m.repairBinding(ctx, pair)
+		if isDeprovisionTriggered(err) {
+			return
+		}
+		if err != nil {
+			fmt.Fprintln(output, err.Error())
+			failuresBuffer.WriteString(err.Error() + "\n")
+			continue
+		}
+		repaired++
+		if pair.svcatBinding.DeletionTimestamp.IsZero() {
+			pair := pair
+			rechecks = append(rechecks, func() error { return checkBindingSurvived(pair) })
+		}
+	}
+	for _, err := range m.recheckSurvived(rechecks) {
+		if isDeprovisionTriggered(err) {
+			return
+		}
+		fmt.Fprintln(output, err.Error())
+		failuresBuffer.WriteString(err.Error() + "\n")
+	}
+
+	if isStopped(runCtx) {
+		return
+	}
+	fmt.Fprintln(output, "*** Repairing binding secrets")
+	count, err := m.repairSecrets(ctx, bindings, &failuresBuffer)
+	if err != nil {
+		fmt.Fprintln(output, fmt.Sprintf("failed to list binding secrets: %v", err.Error()))
+		failuresBuffer.WriteString(fmt.Sprintf("failed to list binding secrets: %v\n", err.Error()))
+	}
+	repaired += count
+
+	if isStopped(runCtx) {
+		return
+	}
+	fmt.Fprintln(output, "*** Checking for SM resources without k8s resources")
+	for _, subaccount := range m.getSubaccounts() {
+		m.checkOrphanedInstances(ctx, subaccount.smInstances, instances, &failuresBuffer)
+		m.checkOrphanedBindings(ctx, subaccount.smBindings, bindings, &failuresBuffer)
+	}
+}
+
+func (m *Migrator) repairInstance(ctx context.Context, pair serviceInstancePair) error {
+	fmt.Fprintln(output, fmt.Sprintf("repairing service instance '%s' in namespace '%s' (smID: '%s')", pair.svcatInstance.Name, pair.svcatInstance.Namespace, pair.smInstance.ID))
+	res, err := m.getOperatorInstance(ctx, pair.svcatInstance.Namespace, pair.targetName)
+	if err != nil {
+		return fmt.Errorf("failed to get operator instance '%s'. Error: %v", pair.targetName, err.Error())
+	}
+	if res == nil {
+		fmt.Fprintln(output, fmt.Sprintf("instance has k8sname '%s' in SM but no operator instance, creating it", pair.targetName))
+		instance, err := m.getInstanceStruct(pair)
+		if err != nil {
+			return err
+		}
+		res, err = m.createOperatorInstance(ctx, instance)
+		if err != nil {
+			return err
+		}
+	} else if !isMigratedInstance(res, pair.smInstance.ID) {
+		return fmt.Errorf("operator instance '%s' in namespace '%s' was not created by the migration of SM instance '%s', skipping it",
+			res.Name, res.Namespace, pair.smInstance.ID)
+	} else if len(pair.svcatInstance.Finalizers) == 0 {
+		fmt.Fprintln(output, "svcat instance has no finalizers but was not deleted, deleting it")
+	}
+
+	err = m.completeInstanceMigration(ctx, pair, res)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(output, "instance repaired successfully")
+	return nil
+}
+
+func (m *Migrator) repairBinding(ctx context.Context, pair serviceBindingPair) error {
+	fmt.Fprintln(output, fmt.Sprintf("repairing service binding '%s' in namespace '%s' (smID: '%s')", pair.svcatBinding.Name, pair.svcatBinding.Namespace, pair.smBinding.ID))
+	secret, err := m.getBindingSecret(ctx, pair)
+	if err != nil {
+		return err
+	}
+
+	res, err := m.getOperatorBinding(ctx, pair.svcatBinding.Namespace, pair.targetName)
+	if err != nil {
+		return fmt.Errorf("failed to get operator binding '%s'. Error: %v", pair.targetName, err.Error())
+	}
+	if res != nil && !isMigratedBinding(res, pair.smBinding.ID) {
+		return fmt.Errorf("operator binding '%s' in namespace '%s' was not created by the migration of SM binding '%s', skipping it",
+			res.Name, res.Namespace, pair.smBinding.ID)
+	}
+
+	secret, err = m.labelBindingSecret(ctx, pair, secret)
+	if err != nil {
+		return err
+	}
+
+	if res == nil {
+		fmt.Fprintln(output, fmt.Sprintf("binding has k8sname '%s' in SM but no operator binding, creating it", pair.targetName))
+		smInstance, err := pair.subaccount.smClient.GetInstanceByID(pair.smBinding.ServiceInstanceID, nil)
+		if err != nil {
+			return fmt.Errorf("failed to get SM instance '%s' of binding. Error: %v", pair.smBinding.ServiceInstanceID, err.Error())
+		}
+		if instanceName := getK8sName(smInstance.Labels); instanceName != "" {
+			pair.instanceTargetName = instanceName
+		}
+		binding, err := m.getBindingStruct(pair)
+		if err != nil {
+			return err
+		}
+		res, err = m.createOperatorBinding(ctx, binding)
+		if err != nil {
+			return err
+		}
+	} else if len(pair.svcatBinding.Finalizers) == 0 {
+		fmt.Fprintln(output, "svcat binding has no finalizers but was not deleted, deleting it")
+	}
+
+	err = m.completeBindingMigration(ctx, pair, secret, res)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(output, "binding repaired successfully")
+	return nil
+}
+
+// repairSecrets sets the operator binding as owner of binding secrets that were labeled during migration but have no owner.
+// Only secrets of a migrated operator binding or of a svcat binding to repair are considered, other secrets may carry
+// a binding label of their own.
+func (m *Migrator) repairSecrets(ctx context.Context, bindings []serviceBindingPair, failuresBuffer *bytes.Buffer) (int, error) {
+	svcatSecrets := make(map[string]bool, len(bindings))
+	for _, pair := range bindings {
+		svcatSecrets[namespacedName(pair.svcatBinding.Namespace, getOperatorSecretName(pair))] = true
+	}
+
+	secrets, err := m.ClientSet.CoreV1().Secrets("").List(ctx, metav1.ListOptions{LabelSelector: "binding"})
+	if err != nil {
+		return 0, err
+	}
+
+	repaired := 0
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if len(secret.OwnerReferences) > 0 {
+			continue
+		}
+		bindingName := secret.Labels["binding"]
+		res, err := m.getOperatorBinding(ctx, secret.Namespace, bindingName)
+		migrated := err == nil && res != nil && res.Labels["migrated"] == "true" && res.Spec.SecretName == secret.Name
+		if !migrated && !svcatSecrets[namespacedName(secret.Namespace, secret.Name)] {
+			continue
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to get operator binding '%s' of secret '%s' in namespace '%s'. Error: %v", bindingName, secret.Name, secret.Namespace, err.Error())
+		} else if !migrated {
+			err = fmt.Errorf("secret '%s' in namespace '%s' is labeled for binding '%s' but no migrated operator binding was found", secret.Name, secret.Namespace, bindingName)
+		} else {
+			fmt.Fprintln(output, fmt.Sprintf("secret '%s' in namespace '%s' has no owner, setting operator binding '%s' as owner", secret.Name, secret.Namespace, bindingName))
+			err = m.setSecretOwner(ctx, secret, res)
+		}
+		if err != nil {
+			fmt.Fprintln(output, err.Error())
+			failuresBuffer.WriteString(err.Error() + "\n")
+			continue
+		}
+		repaired++
+	}
+	return repaired, nil
+}
+
+// checkOrphanedInstances reports SM instances that were handed over to k8s but have neither a svcat nor an operator instance
+func (m *Migrator) checkOrphanedInstances(ctx context.Context, smInstances *types.ServiceInstances, instances []serviceInstancePair, failuresBuffer *bytes.Buffer) {
+	matched := make(map[string]bool, len(instances))
+	for _, pair := range instances {
+		matched[pair.smInstance.ID] = true
+	}
+	for _, smInstance := range smInstances.ServiceInstances {
+		k8sName := getK8sName(smInstance.Labels)
+		if k8sName == "" || matched[smInstance.ID] {
+			continue
+		}
+		namespace := getContextNamespace(smInstance.Context)
+		res, err := m.getOperatorInstance(ctx, namespace, k8sName)
+		if err == nil && res != nil {
+			continue
+		}
+		msg := fmt.Sprintf("SM instance '%s' (%s) has k8sname '%s' in namespace '%s' but no svcat or operator instance, it must be recreated manually", smInstance.Name, smInstance.ID, k8sName, namespace)
+		if err != nil {
+			msg = fmt.Sprintf("failed to get operator instance '%s' in namespace '%s'. Error: %v", k8sName, namespace, err.Error())
+		}
+		fmt.Fprintln(output, msg)
+		failuresBuffer.WriteString(msg + "\n")
+	}
+}
+
+// checkOrphanedBindings reports SM bindings that were handed over to k8s but have neither a svcat nor an operator binding
+func (m *Migrator) checkOrphanedBindings(ctx context.Context, smBindings *types.ServiceBindings, bindings []serviceBindingPair, failuresBuffer *bytes.Buffer) {
+	matched := make(map[string]bool, len(bindings))
+	for _, pair := range bindings {
+		matched[pair.smBinding.ID] = true
+	}
+	for _, smBinding := range smBindings.ServiceBindings {
+		k8sName := getK8sName(smBinding.Labels)
+		if k8sName == "" || matched[smBinding.ID] {
+			continue
+		}
+		namespace := getContextNamespace(smBinding.Context)
+		res, err := m.getOperatorBinding(ctx, namespace, k8sName)
+		if err == nil && res != nil {
+			continue
+		}
+		msg := fmt.Sprintf("SM binding '%s' (%s) has k8sname '%s' in namespace '%s' but no svcat or operator binding, it must be recreated manually", smBinding.Name, smBinding.ID, k8sName, namespace)
+		if err != nil {
+			msg = fmt.Sprintf("failed to get operator binding '%s' in namespace '%s'. Error: %v", k8sName, namespace, err.Error())
+		}
+		fmt.Fprintln(output, msg)
+		failuresBuffer.WriteString(msg + "\n")
+	}
+}
+
+func getK8sName(labels smTypes.Labels) string {
+	if values := labels[k8sNameLabel]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func getContextNamespace(smContext json.RawMessage) string {
+	context := struct {
+		Namespace string `json:"namespace"`
+	}{}
+	if err := json.Unmarshal(smContext, &context); err != nil {
+		return ""
+	}
+	return context.Namespace
+}
@@ -0,0 +1,172 @@
+package migrate
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+const (
+	DefaultSMMaxAttempts = 5
+
+	retryBaseDelay     = time.Second
+	retryMaxDelay      = 30 * time.Second
+	retryMaxRetryAfter = 2 * time.Minute
+)
+
+// retryingClient retries idempotent SM requests failing with a network error or a transient status code,
+// with exponential backoff and jitter, or after the delay requested by SM in the Retry-After header.
+// A request SM rejects as unauthorized is sent once more with a new token, as the token may expire or be revoked early.
+type retryingClient struct {
+	client      *http.Client
+	tokens      *smTokenSource
+	maxAttempts int
+	limiter     flowcontrol.RateLimiter
+	retries     *retryReport
+}
+
+func newRetryingClient(client *http.Client, tokens *smTokenSource, options SMClientOptions) *retryingClient {
+	maxAttempts := options.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &retryingClient{
+		client:      client,
+		tokens:      tokens,
+		maxAttempts: maxAttempts,
+		limiter:     options.limiter,
+		retries:     options.retries,
+	}
+}
+
+func (c *retryingClient) Do(req *http.Request) (*http.Response, error) {
+	rewindable := req.Body == nil || req.GetBody != nil
+	retryable := isIdempotent(req.Method) && rewindable
+	tokenRenewed := false
+	for attempt := 1; ; attempt++ {
+		if c.limiter != nil {
+			if err := c.limiter.Wait(req.Context()); err != nil {
+				return nil, err
+			}
+		}
+
+		response, err := c.client.Do(req)
+		var delay time.Duration
+		if err == nil && response.StatusCode == http.StatusUnauthorized && c.tokens != nil && !tokenRenewed && rewindable {
+			// an unauthorized request was not processed, so it is sent again whatever its method, and does not count as an attempt
+			tokenRenewed = true
+			c.tokens.invalidate()
+			c.retries.add(fmt.Sprintf("%s %s was rejected with status code %d, retried with a new token", req.Method, req.URL.Path, response.StatusCode))
+			attempt--
+		} else {
+			if !retryable || attempt >= c.maxAttempts {
+				return response, err
+			}
+			reason := getRetryReason(response, err)
+			if reason == "" {
+				return response, err
+			}
+			delay = getRetryDelay(response, attempt)
+			c.retries.add(fmt.Sprintf("%s %s attempt %d/%d failed with %s, retried after %s", req.Method, req.URL.Path, attempt, c.maxAttempts, reason, delay))
+		}
+		if response != nil {
+			_, _ = io.Copy(ioutil.Discard, response.Body)
+			response.Body.Close()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// getRetryReason returns why the request should be retried, or an empty string if it should not
+func getRetryReason(response *http.Response, err error) string {
+	if err != nil {
+		return fmt.Sprintf("error '%v'", err.Error())
+	}
+	switch response.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return fmt.Sprintf("status code %d", response.StatusCode)
+	}
+	return ""
+}
+
+// getRetryDelay returns the delay requested by the Retry-After header, or an exponential backoff with jitter
+func getRetryDelay(response *http.Response, attempt int) time.Duration {
+	if response != nil {
+		if retryAfter := response.Header.Get("Retry-After"); retryAfter != "" {
+			var delay time.Duration
+			if seconds, err := strconv.Atoi(retryAfter); err == nil {
+				delay = time.Duration(seconds) * time.Second
+			} else if date, err := http.ParseTime(retryAfter); err == nil {
+				delay = time.Until(date)
+			}
+			if delay > 0 {
+				if delay > retryMaxRetryAfter {
+					delay = retryMaxRetryAfter
+				}
+				return delay
+			}
+		}
+	}
+
+	delay := retryBaseDelay << uint(attempt-1)
+	if delay > retryMaxDelay || delay <= 0 {
+		delay = retryMaxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// retryReport records the retried SM requests, so they appear in the summary
+type retryReport struct {
+	lock    sync.Mutex
+	entries []string
+}
+
+func (r *retryReport) add(entry string) {
+	fmt.Fprintln(output, entry)
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.entries = append(r.entries, entry)
+}
+
+func (r *retryReport) print() {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.entries) == 0 {
+		return
+	}
+	fmt.Fprintln(output, fmt.Sprintf("*** Retried SM requests %d times:", len(r.entries)))
+	for _, entry := range r.entries {
+		fmt.Fprintln(output, entry)
+	}
+}
@@ -0,0 +1,177 @@
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// recordingServer answers SM requests with the given status codes in turn, and 200 once they are used up
+type recordingServer struct {
+	lock     sync.Mutex
+	statuses []int
+	header   http.Header
+	bodies   []string
+	tokens   []string
+}
+
+func (s *recordingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	body, _ := ioutil.ReadAll(r.Body)
+	s.bodies = append(s.bodies, string(body))
+	s.tokens = append(s.tokens, r.Header.Get("Authorization"))
+
+	status := http.StatusOK
+	if len(s.statuses) > 0 {
+		status, s.statuses = s.statuses[0], s.statuses[1:]
+	}
+	if status != http.StatusOK {
+		for key, values := range s.header {
+			w.Header()[key] = values
+		}
+	}
+	w.WriteHeader(status)
+}
+
+func newTestRetryingClient(maxAttempts int) (*retryingClient, *int) {
+	fetched := 0
+	tokens := &smTokenSource{fetch: func() (*oauth2.Token, error) {
+		fetched++
+		return &oauth2.Token{AccessToken: fmt.Sprintf("token-%d", fetched), Expiry: time.Now().Add(time.Hour)}, nil
+	}}
+	client := &http.Client{Transport: &oauth2.Transport{Source: tokens, Base: http.DefaultTransport}}
+	return newRetryingClient(client, tokens, SMClientOptions{MaxAttempts: maxAttempts}), &fetched
+}
+
+func TestRetryRewindsPutBody(t *testing.T) {
+	server := &recordingServer{statuses: []int{http.StatusServiceUnavailable}, header: http.Header{"Retry-After": []string{"1"}}}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	client, _ := newTestRetryingClient(DefaultSMMaxAttempts)
+
+	request, err := http.NewRequest(http.MethodPut, httpServer.URL+"/v1/migrate/service_instances/id", bytes.NewBufferString(`{"name":"instance"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("expected status code 200, got %d", response.StatusCode)
+	}
+	if len(server.bodies) != 2 || server.bodies[0] != `{"name":"instance"}` || server.bodies[1] != server.bodies[0] {
+		t.Errorf("expected the body to be sent twice, got %q", server.bodies)
+	}
+}
+
+func TestRetryStopsAfterMaxAttempts(t *testing.T) {
+	server := &recordingServer{statuses: []int{http.StatusTooManyRequests, http.StatusTooManyRequests}, header: http.Header{"Retry-After": []string{"1"}}}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	client, _ := newTestRetryingClient(2)
+
+	response, err := client.Do(mustNewRequest(t, http.MethodGet, httpServer.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusTooManyRequests || len(server.bodies) != 2 {
+		t.Errorf("expected 2 attempts ending with status code 429, got %d attempts and status code %d", len(server.bodies), response.StatusCode)
+	}
+}
+
+func TestRetryDoesNotRetryPost(t *testing.T) {
+	server := &recordingServer{statuses: []int{http.StatusServiceUnavailable}}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	client, _ := newTestRetryingClient(DefaultSMMaxAttempts)
+
+	response, err := client.Do(mustNewRequest(t, http.MethodPost, httpServer.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusServiceUnavailable || len(server.bodies) != 1 {
+		t.Errorf("expected a single attempt, got %d attempts and status code %d", len(server.bodies), response.StatusCode)
+	}
+}
+
+func TestRetryRenewsRejectedToken(t *testing.T) {
+	server := &recordingServer{statuses: []int{http.StatusUnauthorized, http.StatusUnauthorized}}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	client, fetched := newTestRetryingClient(1)
+
+	response, err := client.Do(mustNewRequest(t, http.MethodPost, httpServer.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	// the token is renewed once, a second rejection is returned
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected status code 401, got %d", response.StatusCode)
+	}
+	if *fetched != 2 || len(server.tokens) != 2 || server.tokens[0] != "Bearer token-1" || server.tokens[1] != "Bearer token-2" {
+		t.Errorf("expected a single retry with a new token, got %d tokens fetched and requests with %q", *fetched, server.tokens)
+	}
+}
+
+func TestRetryDelayFromRetryAfterSeconds(t *testing.T) {
+	if delay := getRetryDelay(newRetryAfterResponse("7"), 1); delay != 7*time.Second {
+		t.Errorf("expected 7s, got %s", delay)
+	}
+}
+
+func TestRetryDelayFromRetryAfterDate(t *testing.T) {
+	date := time.Now().Add(20 * time.Second).UTC().Format(http.TimeFormat)
+	if delay := getRetryDelay(newRetryAfterResponse(date), 1); delay < 18*time.Second || delay > 20*time.Second {
+		t.Errorf("expected about 20s, got %s", delay)
+	}
+}
+
+func TestRetryDelayCapsRetryAfter(t *testing.T) {
+	if delay := getRetryDelay(newRetryAfterResponse(strconv.Itoa(int(time.Hour.Seconds()))), 1); delay != retryMaxRetryAfter {
+		t.Errorf("expected %s, got %s", retryMaxRetryAfter, delay)
+	}
+}
+
+func TestRetryDelayBackoffBounds(t *testing.T) {
+	for attempt := 1; attempt <= 40; attempt++ {
+		max := retryBaseDelay << uint(attempt-1)
+		if max > retryMaxDelay || max <= 0 {
+			max = retryMaxDelay
+		}
+		for i := 0; i < 20; i++ {
+			if delay := getRetryDelay(newRetryAfterResponse("invalid"), attempt); delay < max/2 || delay > max {
+				t.Fatalf("attempt %d: expected a delay between %s and %s, got %s", attempt, max/2, max, delay)
+			}
+		}
+	}
+}
+
+func newRetryAfterResponse(retryAfter string) *http.Response {
+	return &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{"Retry-After": []string{retryAfter}}}
+}
+
+func mustNewRequest(t *testing.T, method, url string) *http.Request {
+	request, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return request
+}
@@ -0,0 +1,133 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	smTypes "github.com/Peripli/service-manager/pkg/types"
+	"github.com/SAP/sap-btp-service-operator/client/sm"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// DeprovisionTriggeredError is returned when an SM resource is missing or being deleted after its svcat resource was deleted,
+// the migration must not continue when it occurs
+type DeprovisionTriggeredError struct {
+	ResourceType string
+	Name         string
+	ID           string
+	Reason       string
+}
+
+func (e *DeprovisionTriggeredError) Error() string {
+	return fmt.Sprintf("SM %s '%s' (%s) %s after its svcat resource was deleted", e.ResourceType, e.Name, e.ID, e.Reason)
+}
+
+// svcatDeletionTimeout is how long to wait for a deleted svcat resource to disappear, svcatDeletionSettle how long to wait
+// after migrating a batch of resources for a deprovisioning the svcat controller may have triggered to reach SM
+const (
+	svcatDeletionPollInterval = time.Second
+	svcatDeletionTimeout      = time.Minute
+	svcatDeletionSettle       = 5 * time.Second
+)
+
+// waitForSvcatDeletion waits until the deleted svcat resource is gone, so that SM is verified after the svcat controller
+// is done with it
+func (m *Migrator) waitForSvcatDeletion(ctx context.Context, resourceType, namespace, name string) {
+	err := wait.PollImmediate(svcatDeletionPollInterval, svcatDeletionTimeout, func() (bool, error) {
+		err := m.SvcatRestClient.Get().Namespace(namespace).Resource(resourceType).Name(name).Do(ctx).Error()
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		fmt.Fprintln(output, fmt.Sprintf("svcat resource '%s' in namespace '%s' was not deleted within %s, verifying SM anyway", name, namespace, svcatDeletionTimeout))
+	}
+}
+
+// verifyInstanceSurvived confirms that the SM instance still exists and has no delete operation after the svcat instance was deleted
+func (m *Migrator) verifyInstanceSurvived(ctx context.Context, pair serviceInstancePair) error {
+	m.waitForSvcatDeletion(ctx, ServiceInstances, pair.svcatInstance.Namespace, pair.svcatInstance.Name)
+	return checkInstanceSurvived(pair)
+}
+
+// verifyBindingSurvived confirms that the SM binding still exists and has no delete operation after the svcat binding was deleted
+func (m *Migrator) verifyBindingSurvived(ctx context.Context, pair serviceBindingPair) error {
+	m.waitForSvcatDeletion(ctx, ServiceBindings, pair.svcatBinding.Namespace, pair.svcatBinding.Name)
+	return checkBindingSurvived(pair)
+}
+
+func checkInstanceSurvived(pair serviceInstancePair) error {
+	smInstance, err := pair.subaccount.smClient.GetInstanceByID(pair.smInstance.ID, withLastOperation())
+	if err != nil {
+		return getVerificationError("instance", pair.smInstance.Name, pair.smInstance.ID, err)
+	}
+	if reason := getDeleteOperationReason(smInstance.LastOperation); reason != "" {
+		return &DeprovisionTriggeredError{ResourceType: "instance", Name: pair.smInstance.Name, ID: pair.smInstance.ID, Reason: reason}
+	}
+	return nil
+}
+
+func checkBindingSurvived(pair serviceBindingPair) error {
+	smBinding, err := pair.subaccount.smClient.GetBindingByID(pair.smBinding.ID, withLastOperation())
+	if err != nil {
+		return getVerificationError("binding", pair.smBinding.Name, pair.smBinding.ID, err)
+	}
+	if reason := getDeleteOperationReason(smBinding.LastOperation); reason != "" {
+		return &DeprovisionTriggeredError{ResourceType: "binding", Name: pair.smBinding.Name, ID: pair.smBinding.ID, Reason: reason}
+	}
+	return nil
+}
+
+// recheckSurvived runs the checks of a batch of migrated resources again after a settle period, as a deprovisioning
+// triggered by a still running svcat controller reaches SM asynchronously. It is skipped when the svcat controller was
+// scaled down, as nothing can trigger a deprovisioning then.
+func (m *Migrator) recheckSurvived(checks []func() error) []error {
+	if m.ScaleDownSvcatController || len(checks) == 0 {
+		return nil
+	}
+	fmt.Fprintln(output, fmt.Sprintf("verifying the %d migrated resources in SM again in %s", len(checks), svcatDeletionSettle))
+	time.Sleep(svcatDeletionSettle)
+	var errs []error
+	for _, check := range checks {
+		if err := check(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// getVerificationError returns a DeprovisionTriggeredError if the SM resource was deleted. Other errors only mean that
+// the resource could not be verified, they fail the resource but not the migration.
+func getVerificationError(resourceType, name, id string, err error) error {
+	if smErr, ok := err.(*sm.ServiceManagerError); ok && (smErr.StatusCode == http.StatusNotFound || smErr.StatusCode == http.StatusGone) {
+		return &DeprovisionTriggeredError{ResourceType: resourceType, Name: name, ID: id, Reason: "was deleted"}
+	}
+	return fmt.Errorf("could not verify that SM %s '%s' (%s) survived the deletion of its svcat resource: %v", resourceType, name, id, err.Error())
+}
+
+func getDeleteOperationReason(lastOperation *smTypes.Operation) string {
+	if lastOperation != nil && lastOperation.Type == smTypes.DELETE && lastOperation.State != smTypes.FAILED {
+		return fmt.Sprintf("has a delete operation in state '%s'", lastOperation.State)
+	}
+	return ""
+}
+
+// isDeprovisionTriggered returns true and reports loudly if err means that the migration caused an SM resource deletion
+func isDeprovisionTriggered(err error) bool {
+	deprovisionErr, ok := err.(*DeprovisionTriggeredError)
+	if !ok {
+		return false
+	}
+	banner := strings.Repeat("!", 100)
+	fmt.Fprintln(output, banner)
+	fmt.Fprintln(output, fmt.Sprintf("!!! ABORTING: %s", deprovisionErr.Error()))
+	fmt.Fprintln(output, "!!! Deleting the svcat resource may have triggered deprovisioning in the broker, no further resources will be migrated.")
+	fmt.Fprintln(output, "!!! Check the resource in SM and the svcat controller before running the migration again.")
+	fmt.Fprintln(output, banner)
+	return true
+}
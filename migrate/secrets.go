@@ -0,0 +1,119 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/SvcManager/svcat-operator-migrator/redact"
+	"github.com/kubernetes-sigs/service-catalog/pkg/apis/servicecatalog/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// recreateBindingSecret creates the missing secret of the svcat binding from the binding credentials in SM,
+// using the svcat layout: a key per credentials field, with the binding secret transforms applied
+func (m *Migrator) recreateBindingSecret(ctx context.Context, pair serviceBindingPair) (*corev1.Secret, error) {
+	credentials, err := m.getSMBindingCredentials(pair)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := getSecretDataFromCredentials(credentials)
+	if err != nil {
+		return nil, err
+	}
+	data, err = m.applySecretTransforms(ctx, pair.svcatBinding, credentials, data)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pair.svcatBinding.Spec.SecretName,
+			Namespace: pair.svcatBinding.Namespace,
+		},
+		Data: data,
+	}
+	fmt.Fprintln(output, fmt.Sprintf("recreating secret '%s' from SM credentials", secret.Name))
+	secret, err = m.ClientSet.CoreV1().Secrets(secret.Namespace).Create(ctx, secret, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to recreate binding's secret '%s'. Error: %v", pair.svcatBinding.Spec.SecretName, err.Error())
+	}
+	return secret, nil
+}
+
+// getSecretDataFromCredentials converts credentials to secret data the same way svcat does,
+// string values are kept as is and other values are JSON encoded
+func getSecretDataFromCredentials(credentials map[string]interface{}) (map[string][]byte, error) {
+	data := make(map[string][]byte, len(credentials))
+	for key, value := range credentials {
+		if str, ok := value.(string); ok {
+			data[key] = []byte(str)
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode credentials field '%s'. Error: %v", key, err.Error())
+		}
+		data[key] = encoded
+	}
+	return data, nil
+}
+
+// applySecretTransforms applies the svcat binding secret transforms to the secret data in order
+func (m *Migrator) applySecretTransforms(ctx context.Context, binding *v1beta1.ServiceBinding, credentials map[string]interface{}, data map[string][]byte) (map[string][]byte, error) {
+	for _, transform := range binding.Spec.SecretTransforms {
+		switch {
+		case transform.RenameKey != nil:
+			if value, ok := data[transform.RenameKey.From]; ok {
+				data[transform.RenameKey.To] = value
+				delete(data, transform.RenameKey.From)
+			}
+		case transform.AddKey != nil:
+			value, err := getAddKeyValue(transform.AddKey, credentials)
+			if err != nil {
+				return nil, err
+			}
+			data[transform.AddKey.Key] = value
+		case transform.AddKeysFrom != nil && transform.AddKeysFrom.SecretRef != nil:
+			namespace := transform.AddKeysFrom.SecretRef.Namespace
+			if namespace == "" {
+				namespace = binding.Namespace
+			}
+			source, err := m.ClientSet.CoreV1().Secrets(namespace).Get(ctx, transform.AddKeysFrom.SecretRef.Name, metav1.GetOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("failed to get secret '%s/%s' of addKeysFrom transform. Error: %v", namespace, transform.AddKeysFrom.SecretRef.Name, err.Error())
+			}
+			redact.RegisterBytes(source.Data)
+			for key, value := range source.Data {
+				data[key] = value
+			}
+		case transform.RemoveKey != nil:
+			delete(data, transform.RemoveKey.Key)
+		}
+	}
+	return data, nil
+}
+
+func getAddKeyValue(transform *v1beta1.AddKeyTransform, credentials map[string]interface{}) ([]byte, error) {
+	switch {
+	case transform.Value != nil:
+		return transform.Value, nil
+	case transform.StringValue != nil:
+		return []byte(*transform.StringValue), nil
+	case transform.JSONPathExpression != nil:
+		path := jsonpath.New(transform.Key)
+		if err := path.Parse(*transform.JSONPathExpression); err != nil {
+			return nil, fmt.Errorf("failed to parse jsonPathExpression of addKey '%s'. Error: %v", transform.Key, err.Error())
+		}
+		var buffer bytes.Buffer
+		if err := path.Execute(&buffer, credentials); err != nil {
+			return nil, fmt.Errorf("failed to evaluate jsonPathExpression of addKey '%s'. Error: %v", transform.Key, err.Error())
+		}
+		return buffer.Bytes(), nil
+	}
+	return []byte{}, nil
+}
@@ -0,0 +1,208 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	smTypes "github.com/Peripli/service-manager/pkg/types"
+	"github.com/SAP/sap-btp-service-operator/client/sm"
+	"github.com/kubernetes-sigs/service-catalog/pkg/apis/servicecatalog/v1beta1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const stabilityPollInterval = 10 * time.Second
+
+// withLastOperation returns the parameters of an SM request attaching the last operation of the returned resources,
+// which is needed to detect resources with SM operations in progress or being deleted
+func withLastOperation(fieldQuery ...string) *sm.Parameters {
+	return &sm.Parameters{FieldQuery: fieldQuery, GeneralParams: []string{"attach_last_operations=true"}}
+}
+
+// ensureStable checks that all the resources are in a stable state both in svcat and in SM.
+// If WaitForStable is set, unstable resources are polled until they settle or the timeout expires.
+// Resources that remain unstable are either skipped (SkipUnstable), together with the bindings of skipped instances,
+// or reported as blocking.
+func (m *Migrator) ensureStable(ctx context.Context, runCtx context.Context, instances []serviceInstancePair, bindings []serviceBindingPair) ([]serviceInstancePair, []serviceBindingPair, int, bytes.Buffer) {
+	unstableInstances, unstableBindings := m.getUnstableResources(instances, bindings)
+	if m.WaitForStable > 0 && len(unstableInstances)+len(unstableBindings) > 0 {
+		fmt.Fprintln(output, fmt.Sprintf("found %d unstable resources, waiting up to %s for them to become stable", len(unstableInstances)+len(unstableBindings), m.WaitForStable))
+		err := wait.PollImmediate(stabilityPollInterval, m.WaitForStable, func() (bool, error) {
+			if runCtx.Err() != nil {
+				return false, runCtx.Err()
+			}
+			instances = m.refreshInstances(ctx, instances, unstableInstances)
+			bindings = m.refreshBindings(ctx, bindings, unstableBindings)
+			unstableInstances, unstableBindings = m.getUnstableResources(instances, bindings)
+			return len(unstableInstances)+len(unstableBindings) == 0, nil
+		})
+		if err != nil && runCtx.Err() == nil {
+			fmt.Fprintln(output, fmt.Sprintf("timed out waiting for resources to become stable: %v", err.Error()))
+		}
+	}
+
+	var buffer bytes.Buffer
+	count := 0
+	skippedInstances := make(map[string]bool)
+	stableInstances := make([]serviceInstancePair, 0, len(instances))
+	for _, pair := range instances {
+		reason, unstable := unstableInstances[pair.smInstance.ID]
+		if !unstable {
+			stableInstances = append(stableInstances, pair)
+			continue
+		}
+		msg := fmt.Sprintf("instance '%s' in namespace '%s' is not stable: %s", pair.svcatInstance.Name, pair.svcatInstance.Namespace, reason)
+		if m.SkipUnstable {
+			fmt.Fprintln(output, msg+", skipping it...")
+			skippedInstances[namespacedName(pair.svcatInstance.Namespace, pair.svcatInstance.Name)] = true
+			continue
+		}
+		count++
+		buffer.WriteString(msg + "\n")
+	}
+
+	stableBindings := make([]serviceBindingPair, 0, len(bindings))
+	for _, pair := range bindings {
+		// the operator binding of a skipped instance would reference an operator instance that does not exist
+		if skippedInstances[namespacedName(pair.svcatBinding.Namespace, pair.svcatBinding.Spec.InstanceRef.Name)] {
+			fmt.Fprintln(output, fmt.Sprintf("binding '%s' in namespace '%s' belongs to skipped instance '%s', skipping it...", pair.svcatBinding.Name, pair.svcatBinding.Namespace, pair.svcatBinding.Spec.InstanceRef.Name))
+			continue
+		}
+		reason, unstable := unstableBindings[pair.smBinding.ID]
+		if !unstable {
+			stableBindings = append(stableBindings, pair)
+			continue
+		}
+		msg := fmt.Sprintf("binding '%s' in namespace '%s' is not stable: %s", pair.svcatBinding.Name, pair.svcatBinding.Namespace, reason)
+		if m.SkipUnstable {
+			fmt.Fprintln(output, msg+", skipping it...")
+			continue
+		}
+		count++
+		buffer.WriteString(msg + "\n")
+	}
+
+	return stableInstances, stableBindings, count, buffer
+}
+
+// getUnstableResources returns the reason of instability per SM ID of the unstable instances and bindings
+func (m *Migrator) getUnstableResources(instances []serviceInstancePair, bindings []serviceBindingPair) (map[string]string, map[string]string) {
+	unstableInstances := make(map[string]string)
+	for _, pair := range instances {
+		if reason := getInstanceUnstableReason(pair); reason != "" {
+			unstableInstances[pair.smInstance.ID] = reason
+		}
+	}
+
+	unstableBindings := make(map[string]string)
+	for _, pair := range bindings {
+		if reason := getBindingUnstableReason(pair); reason != "" {
+			unstableBindings[pair.smBinding.ID] = reason
+		}
+	}
+	return unstableInstances, unstableBindings
+}
+
+func (m *Migrator) refreshInstances(ctx context.Context, instances []serviceInstancePair, unstable map[string]string) []serviceInstancePair {
+	refreshed := make([]serviceInstancePair, 0, len(instances))
+	for _, pair := range instances {
+		if _, ok := unstable[pair.smInstance.ID]; !ok {
+			refreshed = append(refreshed, pair)
+			continue
+		}
+		svcatInstance := &v1beta1.ServiceInstance{}
+		err := m.SvcatRestClient.Get().Namespace(pair.svcatInstance.Namespace).Resource(ServiceInstances).Name(pair.svcatInstance.Name).Do(ctx).Into(svcatInstance)
+		if err != nil {
+			fmt.Fprintln(output, fmt.Sprintf("failed to refresh svcat instance '%s': %v", pair.svcatInstance.Name, err.Error()))
+			refreshed = append(refreshed, pair)
+			continue
+		}
+		smInstance, err := pair.subaccount.smClient.GetInstanceByID(pair.smInstance.ID, withLastOperation())
+		if err != nil {
+			fmt.Fprintln(output, fmt.Sprintf("failed to refresh SM instance '%s': %v", pair.smInstance.ID, err.Error()))
+			refreshed = append(refreshed, pair)
+			continue
+		}
+		pair.svcatInstance, pair.smInstance = svcatInstance, smInstance
+		refreshed = append(refreshed, pair)
+	}
+	return refreshed
+}
+
+func (m *Migrator) refreshBindings(ctx context.Context, bindings []serviceBindingPair, unstable map[string]string) []serviceBindingPair {
+	refreshed := make([]serviceBindingPair, 0, len(bindings))
+	for _, pair := range bindings {
+		if _, ok := unstable[pair.smBinding.ID]; !ok {
+			refreshed = append(refreshed, pair)
+			continue
+		}
+		svcatBinding := &v1beta1.ServiceBinding{}
+		err := m.SvcatRestClient.Get().Namespace(pair.svcatBinding.Namespace).Resource(ServiceBindings).Name(pair.svcatBinding.Name).Do(ctx).Into(svcatBinding)
+		if err != nil {
+			fmt.Fprintln(output, fmt.Sprintf("failed to refresh svcat binding '%s': %v", pair.svcatBinding.Name, err.Error()))
+			refreshed = append(refreshed, pair)
+			continue
+		}
+		smBinding, err := pair.subaccount.smClient.GetBindingByID(pair.smBinding.ID, withLastOperation())
+		if err != nil {
+			fmt.Fprintln(output, fmt.Sprintf("failed to refresh SM binding '%s': %v", pair.smBinding.ID, err.Error()))
+			refreshed = append(refreshed, pair)
+			continue
+		}
+		pair.svcatBinding, pair.smBinding = svcatBinding, smBinding
+		refreshed = append(refreshed, pair)
+	}
+	return refreshed
+}
+
+func getInstanceUnstableReason(pair serviceInstancePair) string {
+	status := pair.svcatInstance.Status
+	if status.AsyncOpInProgress || status.CurrentOperation != "" {
+		return fmt.Sprintf("svcat operation '%s' is in progress", status.CurrentOperation)
+	}
+	for _, condition := range status.Conditions {
+		if condition.Type == v1beta1.ServiceInstanceConditionFailed && condition.Status == v1beta1.ConditionTrue {
+			return fmt.Sprintf("svcat instance is in failed state: %s", condition.Message)
+		}
+	}
+	if pair.svcatInstance.Generation > status.ReconciledGeneration {
+		return fmt.Sprintf("svcat instance has pending update requests (generation %d, reconciled generation %d)", pair.svcatInstance.Generation, status.ReconciledGeneration)
+	}
+	if !pair.smInstance.Ready {
+		return "instance is not ready in SM"
+	}
+	if !pair.smInstance.Usable {
+		return "instance is not usable in SM"
+	}
+	return getLastOperationUnstableReason(pair.smInstance.LastOperation)
+}
+
+func getBindingUnstableReason(pair serviceBindingPair) string {
+	status := pair.svcatBinding.Status
+	if status.AsyncOpInProgress || status.CurrentOperation != "" {
+		return fmt.Sprintf("svcat operation '%s' is in progress", status.CurrentOperation)
+	}
+	for _, condition := range status.Conditions {
+		if condition.Type == v1beta1.ServiceBindingConditionFailed && condition.Status == v1beta1.ConditionTrue {
+			return fmt.Sprintf("svcat binding is in failed state: %s", condition.Message)
+		}
+	}
+	if !pair.smBinding.Ready {
+		return "binding is not ready in SM"
+	}
+	return getLastOperationUnstableReason(pair.smBinding.LastOperation)
+}
+
+func getLastOperationUnstableReason(operation *smTypes.Operation) string {
+	if operation == nil {
+		return ""
+	}
+	switch operation.State {
+	case smTypes.PENDING, smTypes.IN_PROGRESS:
+		return fmt.Sprintf("SM %s operation is %s", operation.Type, operation.State)
+	case smTypes.FAILED:
+		return fmt.Sprintf("SM last %s operation failed", operation.Type)
+	}
+	return ""
+}
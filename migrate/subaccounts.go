@@ -0,0 +1,130 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/SAP/sap-btp-service-operator/client/sm"
+	"github.com/SAP/sap-btp-service-operator/client/sm/types"
+	"github.com/SvcManager/svcat-operator-migrator/redact"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// operatorSecretName is the name of the operator SM credentials secret, namespace specific credentials use it in
+// the namespace itself or prefixed with the namespace name in the managed namespace
+const operatorSecretName = "sap-btp-service-operator"
+
+// subaccount is an SM subaccount the operator has credentials for, with its catalog and the SM resources of the cluster in it
+type subaccount struct {
+	// name is the credentials secret of the subaccount
+	name string
+	// credentialsKey identifies the credentials of the subaccount, see getCredentialsKey
+	credentialsKey string
+	smClient       sm.Client
+	// services and plans are the part of the catalog the instances to migrate need, see loadCatalogs
+	services map[string]types.ServiceOffering
+	plans    map[string]types.ServicePlan
+
+	smInstances *types.ServiceInstances
+	smBindings  *types.ServiceBindings
+	// smInstancesByID and smBindingsByID index the SM resources for matching them with svcat resources
+	smInstancesByID map[string]*types.ServiceInstance
+	smBindingsByID  map[string]*types.ServiceBinding
+}
+
+func newSubaccount(name string, credentialsKey string, smClient sm.Client) *subaccount {
+	return &subaccount{
+		name:           name,
+		credentialsKey: credentialsKey,
+		smClient:       smClient,
+	}
+}
+
+// loadNamespaceSubaccounts detects namespace specific operator credentials and creates a subaccount for each distinct set of credentials.
+// As in the operator, a secret in the namespace itself takes precedence over a namespace prefixed secret in the managed namespace.
+func (m *Migrator) loadNamespaceSubaccounts(ctx context.Context, defaultSecret *corev1.Secret, smClientOptions SMClientOptions) {
+	secrets := make(map[string]*corev1.Secret)
+
+	managedSecrets, err := m.ClientSet.CoreV1().Secrets(m.ManagedNamespace).List(ctx, metav1.ListOptions{})
+	cobra.CheckErr(redact.Error(err))
+	for i, secret := range managedSecrets.Items {
+		if namespace := strings.TrimSuffix(secret.Name, "-"+operatorSecretName); namespace != secret.Name && namespace != "" {
+			secrets[namespace] = &managedSecrets.Items[i]
+		}
+	}
+
+	namespaceSecrets, err := m.ClientSet.CoreV1().Secrets("").List(ctx, metav1.ListOptions{FieldSelector: "metadata.name=" + operatorSecretName})
+	cobra.CheckErr(redact.Error(err))
+	for i, secret := range namespaceSecrets.Items {
+		if secret.Namespace != m.ManagedNamespace {
+			secrets[secret.Namespace] = &namespaceSecrets.Items[i]
+		}
+	}
+
+	if len(secrets) == 0 {
+		return
+	}
+
+	namespaces := make([]string, 0, len(secrets))
+	for namespace := range secrets {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	byCredentials := map[string]*subaccount{getCredentialsKey(defaultSecret): m.defaultSubaccount}
+	m.namespaceSubaccounts = make(map[string]*subaccount, len(secrets))
+	for _, namespace := range namespaces {
+		secret := secrets[namespace]
+		key := getCredentialsKey(secret)
+		name := namespacedName(secret.Namespace, secret.Name)
+		fmt.Fprintln(output, fmt.Sprintf("Using SM credentials '%s' for namespace '%s'", name, namespace))
+		if _, ok := byCredentials[key]; !ok {
+			byCredentials[key] = newSubaccount(name, key, GetSMClient(ctx, secret, smClientOptions))
+		}
+		m.namespaceSubaccounts[namespace] = byCredentials[key]
+	}
+}
+
+// indexSMResources indexes the fetched SM instances and bindings by ID
+func (s *subaccount) indexSMResources() {
+	s.smInstancesByID = make(map[string]*types.ServiceInstance, len(s.smInstances.ServiceInstances))
+	for i := range s.smInstances.ServiceInstances {
+		s.smInstancesByID[s.smInstances.ServiceInstances[i].ID] = &s.smInstances.ServiceInstances[i]
+	}
+	s.smBindingsByID = make(map[string]*types.ServiceBinding, len(s.smBindings.ServiceBindings))
+	for i := range s.smBindings.ServiceBindings {
+		s.smBindingsByID[s.smBindings.ServiceBindings[i].ID] = &s.smBindings.ServiceBindings[i]
+	}
+}
+
+// getSubaccount returns the subaccount the resources of the namespace belong to
+func (m *Migrator) getSubaccount(namespace string) *subaccount {
+	if subaccount, ok := m.namespaceSubaccounts[namespace]; ok {
+		return subaccount
+	}
+	return m.defaultSubaccount
+}
+
+// getSubaccounts returns the distinct subaccounts, the default one first
+func (m *Migrator) getSubaccounts() []*subaccount {
+	subaccounts := []*subaccount{m.defaultSubaccount}
+	seen := map[*subaccount]bool{m.defaultSubaccount: true}
+	for _, subaccount := range m.namespaceSubaccounts {
+		if !seen[subaccount] {
+			seen[subaccount] = true
+			subaccounts = append(subaccounts, subaccount)
+		}
+	}
+	others := subaccounts[1:]
+	sort.Slice(others, func(i, j int) bool { return others[i].name < others[j].name })
+	return subaccounts
+}
+
+// getCredentialsKey identifies the subaccount and technical user of an operator credentials secret
+func getCredentialsKey(secret *corev1.Secret) string {
+	return string(secret.Data["url"]) + "|" + string(secret.Data["clientid"])
+}
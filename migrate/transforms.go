@@ -0,0 +1,62 @@
+package migrate
+
+import (
+	"fmt"
+
+	"github.com/kubernetes-sigs/service-catalog/pkg/apis/servicecatalog/v1beta1"
+)
+
+// analyzeSecretTransforms reports the secret transforms of the svcat bindings. The operator binding spec has no options
+// for shaping its secret, so none of the transforms can be expressed: the transformed layout is only kept in the
+// credentials uploaded to SM during migration, and is lost once the operator re-creates the binding or rotates its credentials.
+// Returns the number of bindings with secret transforms.
+func (m *Migrator) analyzeSecretTransforms(bindings []serviceBindingPair) int {
+	count := 0
+	for _, pair := range bindings {
+		if len(pair.svcatBinding.Spec.SecretTransforms) == 0 {
+			continue
+		}
+		count++
+		fmt.Fprintln(output, fmt.Sprintf("binding '%s' in namespace '%s' has %d secret transforms not expressible in operator binding:", pair.svcatBinding.Name, pair.svcatBinding.Namespace, len(pair.svcatBinding.Spec.SecretTransforms)))
+		for _, transform := range pair.svcatBinding.Spec.SecretTransforms {
+			finding := getSecretTransformFinding(transform)
+			fmt.Fprintln(output, fmt.Sprintf("  - %s: %s", finding.field, finding.details))
+		}
+	}
+	return count
+}
+
+func getSecretTransformFinding(transform v1beta1.SecretTransform) compatibilityFinding {
+	const preserved = "the current secret layout is kept in the migrated credentials but is lost when the credentials are rotated"
+	switch {
+	case transform.RenameKey != nil:
+		return compatibilityFinding{
+			field:   fmt.Sprintf("renameKey '%s' to '%s'", transform.RenameKey.From, transform.RenameKey.To),
+			details: preserved,
+		}
+	case transform.AddKey != nil:
+		details := preserved
+		if transform.AddKey.JSONPathExpression != nil {
+			details = fmt.Sprintf("value derived from '%s', %s", *transform.AddKey.JSONPathExpression, preserved)
+		}
+		return compatibilityFinding{
+			field:   fmt.Sprintf("addKey '%s'", transform.AddKey.Key),
+			details: details,
+		}
+	case transform.AddKeysFrom != nil:
+		source := ""
+		if transform.AddKeysFrom.SecretRef != nil {
+			source = fmt.Sprintf("%s/%s", transform.AddKeysFrom.SecretRef.Namespace, transform.AddKeysFrom.SecretRef.Name)
+		}
+		return compatibilityFinding{
+			field:   fmt.Sprintf("addKeysFrom secret '%s'", source),
+			details: "changes of the source secret are no longer propagated, " + preserved,
+		}
+	case transform.RemoveKey != nil:
+		return compatibilityFinding{
+			field:   fmt.Sprintf("removeKey '%s'", transform.RemoveKey.Key),
+			details: preserved,
+		}
+	}
+	return compatibilityFinding{field: "unknown transform", details: "it is ignored"}
+}
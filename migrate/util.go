@@ -2,24 +2,177 @@ package migrate
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
 	"github.com/SAP/sap-btp-service-operator/client/sm"
+	"github.com/SvcManager/svcat-operator-migrator/redact"
 	"github.com/spf13/cobra"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+const (
+	defaultTokenURLSuffix = "/oauth/token"
+	tokenRequestTimeout   = 10 * time.Second
 )
 
-func GetSMClient(ctx context.Context, secret *v1.Secret) sm.Client {
+// SMClientOptions configure how the SM clients connect, in addition to the operator credentials
+type SMClientOptions struct {
+	// CABundle is a PEM bundle of CAs to trust for SM and the token URL, in addition to the system CAs
+	CABundle []byte
+	// Credentials replace the operator secret in the managed namespace, keyed as in the operator secret.
+	// Namespace specific credentials are not used when set.
+	Credentials map[string][]byte
+	// MaxAttempts is the number of attempts of idempotent SM requests failing with a transient error, 1 disables retries
+	MaxAttempts int
+	// RateLimit is the maximum number of SM requests per second across all SM clients, 0 for no limit
+	RateLimit float64
+
+	limiter flowcontrol.RateLimiter
+	retries *retryReport
+}
+
+// K8sClientOptions configure how the k8s clients call the API server, zero values keep the client-go defaults
+type K8sClientOptions struct {
+	// QPS and Burst limit the rate of API server requests
+	QPS   float32
+	Burst int
+	// Timeout is the timeout of a single API server request
+	Timeout time.Duration
+}
+
+// apply sets the options on the k8s client config
+func (o K8sClientOptions) apply(config *rest.Config) {
+	if o.QPS > 0 {
+		config.QPS = o.QPS
+	}
+	if o.Burst > 0 {
+		config.Burst = o.Burst
+	}
+	if o.Timeout > 0 {
+		config.Timeout = o.Timeout
+	}
+}
+
+// GetSMClient returns an SM client for the operator credentials secret. Client secret credentials are used unless
+// the secret has a client certificate (tls.crt and tls.key), in which case the token is acquired with mTLS.
+// Idempotent requests are retried on transient failures.
+func GetSMClient(ctx context.Context, secret *v1.Secret, options SMClientOptions) sm.Client {
 	secretData := secret.Data
-	return sm.NewClient(ctx, &sm.ClientConfig{
+	redact.RegisterField("clientsecret", string(secretData["clientsecret"]))
+	redact.RegisterField("tls.key", string(secretData["tls.key"]))
+	config := &sm.ClientConfig{
 		ClientID:     string(secretData["clientid"]),
 		ClientSecret: string(secretData["clientsecret"]),
 		URL:          string(secretData["url"]),
 		TokenURL:     string(secretData["tokenurl"]),
 		SSLDisabled:  false,
-	}, nil)
+	}
+
+	caBundle := append(append([]byte{}, options.CABundle...), secretData["ca.crt"]...)
+	httpClient, tokens, err := getSMHTTPClient(ctx, secretData, caBundle)
+	cobra.CheckErr(redact.Error(err))
+	return sm.NewClient(ctx, config, newRetryingClient(httpClient, tokens, options))
+}
+
+// validateSMCredentials checks that SM credentials not read from the operator secret have what is needed to connect
+func validateSMCredentials(credentials map[string][]byte) error {
+	for _, key := range []string{"url", "tokenurl", "clientid"} {
+		if len(credentials[key]) == 0 {
+			return fmt.Errorf("SM credentials are missing '%s'", key)
+		}
+	}
+	if len(credentials["clientsecret"]) == 0 && (len(credentials["tls.crt"]) == 0 || len(credentials["tls.key"]) == 0) {
+		return fmt.Errorf("SM credentials should have either 'clientsecret' or both 'tls.crt' and 'tls.key'")
+	}
+	return nil
+}
+
+// getSMHTTPClient returns an HTTP client authenticating to SM with OAuth client credentials, over a TLS configuration
+// trusting the CA bundle and presenting the client certificate of the secret, if any. The token source of the client is
+// returned as well, so that a token SM rejects can be dropped.
+func getSMHTTPClient(ctx context.Context, secretData map[string][]byte, caBundle []byte) (*http.Client, *smTokenSource, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(caBundle) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caBundle) {
+			return nil, nil, fmt.Errorf("failed to parse SM CA bundle, no PEM certificates found")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	tokenURL := string(secretData["tokenurl"])
+	if len(secretData["tls.crt"]) > 0 {
+		certificate, err := tls.X509KeyPair(secretData["tls.crt"], secretData["tls.key"])
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load SM client certificate: %v", err.Error())
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+		if certURL := string(secretData["certurl"]); certURL != "" {
+			tokenURL = certURL
+		}
+	}
+	tokenURLSuffix := defaultTokenURLSuffix
+	if suffix := string(secretData["tokenurlsuffix"]); suffix != "" {
+		tokenURLSuffix = suffix
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	ccConfig := &clientcredentials.Config{
+		ClientID:     string(secretData["clientid"]),
+		ClientSecret: string(secretData["clientsecret"]),
+		TokenURL:     tokenURL + tokenURLSuffix,
+		AuthStyle:    oauth2.AuthStyleInParams,
+	}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: transport, Timeout: tokenRequestTimeout})
+	tokens := &smTokenSource{fetch: func() (*oauth2.Token, error) { return ccConfig.Token(ctx) }}
+	return &http.Client{Transport: &oauth2.Transport{Source: tokens, Base: transport}}, tokens, nil
+}
+
+// smTokenSource caches the SM token until it expires or is invalidated, as SM may reject a token before its expiry
+type smTokenSource struct {
+	lock  sync.Mutex
+	fetch func() (*oauth2.Token, error)
+	token *oauth2.Token
+}
+
+func (s *smTokenSource) Token() (*oauth2.Token, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.token.Valid() {
+		return s.token, nil
+	}
+	token, err := s.fetch()
+	if err != nil {
+		return nil, err
+	}
+	s.token = token
+	return token, nil
+}
+
+// invalidate drops the cached token, the next request fetches a new one
+func (s *smTokenSource) invalidate() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.token = nil
 }
 
 func GetK8sClient(config *rest.Config, groupName, groupVersion string) *rest.RESTClient {
@@ -30,6 +183,6 @@ func GetK8sClient(config *rest.Config, groupName, groupVersion string) *rest.RES
 	opcrdConfig.UserAgent = rest.DefaultKubernetesUserAgent()
 
 	operatorClient, err := rest.UnversionedRESTClientFor(&opcrdConfig)
-	cobra.CheckErr(err)
+	cobra.CheckErr(redact.Error(err))
 	return operatorClient
 }
@@ -0,0 +1,234 @@
+// Package redact masks credentials before they reach stdout, stderr or reports.
+// Values known to be secret are registered as they are read, and well known credential fields are masked by pattern.
+package redact
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// Mask replaces redacted values
+	Mask = "<redacted>"
+	// minSubstringLength is the length from which registered values are masked wherever they appear. Shorter values,
+	// such as ports or flags, are masked only next to their key, as masking every "1" or "true" would corrupt the output.
+	minSubstringLength = 6
+	// maxPendingLength is the length of an unterminated line from which a writer redacts and writes it anyway
+	maxPendingLength = 64 * 1024
+)
+
+var (
+	lock sync.RWMutex
+	// byPrefix indexes the registered values of at least minSubstringLength by their first minSubstringLength bytes,
+	// longest first, so redacting does not depend on the number of registered values
+	byPrefix = make(map[string][]string)
+	// shortFields holds the registered values shorter than minSubstringLength by their key
+	shortFields = make(map[string]map[string]bool)
+	// fieldPatterns match the position of the value following each key of shortFields
+	fieldPatterns = make(map[string]*regexp.Regexp)
+
+	patterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)("(?:client_?secret|password|passwd|secret|token|access_token|refresh_token|id_token|private_?key|tls\.key)"\s*:\s*")(?:[^"\\]|\\.)*(")`),
+		regexp.MustCompile(`(?i)((?:client_secret|password|access_token|refresh_token)=)[^&\s"]+()`),
+		regexp.MustCompile(`(?i)((?:Bearer|Basic)\s+)[A-Za-z0-9\-._~+/]+=*()`),
+		regexp.MustCompile(`(-----BEGIN [A-Z ]*PRIVATE KEY-----)[\s\S]*?(-----END [A-Z ]*PRIVATE KEY-----)`),
+	}
+)
+
+// Register marks values as secret, they are masked in everything redacted from now on.
+// Values shorter than minSubstringLength are ignored, register them with their key using RegisterField.
+func Register(secrets ...string) {
+	lock.Lock()
+	defer lock.Unlock()
+	for _, value := range secrets {
+		if len(value) >= minSubstringLength {
+			indexValue(value)
+		}
+	}
+}
+
+// RegisterField marks the value of a secret field as secret. Values shorter than minSubstringLength are masked only
+// where they follow their key, as in "key": "value", key=value or key: value.
+func RegisterField(key, value string) {
+	lock.Lock()
+	defer lock.Unlock()
+	switch {
+	case value == "":
+	case len(value) >= minSubstringLength:
+		indexValue(value)
+	case key != "":
+		if shortFields[key] == nil {
+			shortFields[key] = make(map[string]bool)
+			fieldPatterns[key] = regexp.MustCompile(`(?:^|[^\w.-])"?` + regexp.QuoteMeta(key) + `"?\s*[:=]\s*"?()`)
+		}
+		shortFields[key][value] = true
+	}
+}
+
+// indexValue adds a value to byPrefix, the caller holds the write lock
+func indexValue(value string) {
+	prefix := value[:minSubstringLength]
+	candidates := byPrefix[prefix]
+	i := sort.Search(len(candidates), func(i int) bool { return len(candidates[i]) <= len(value) })
+	for j := i; j < len(candidates) && len(candidates[j]) == len(value); j++ {
+		if candidates[j] == value {
+			return
+		}
+	}
+	candidates = append(candidates, "")
+	copy(candidates[i+1:], candidates[i:])
+	candidates[i] = value
+	byPrefix[prefix] = candidates
+}
+
+// RegisterBytes marks the values of secret data as secret
+func RegisterBytes(data map[string][]byte) {
+	for key, value := range data {
+		RegisterField(key, string(value))
+	}
+}
+
+// RegisterJSON marks every string in a decoded JSON document as secret
+func RegisterJSON(document interface{}) {
+	registerJSON("", document)
+}
+
+func registerJSON(key string, document interface{}) {
+	switch value := document.(type) {
+	case string:
+		RegisterField(key, value)
+	case map[string]interface{}:
+		for fieldKey, field := range value {
+			registerJSON(fieldKey, field)
+		}
+	case []interface{}:
+		for _, item := range value {
+			registerJSON(key, item)
+		}
+	}
+}
+
+// String masks the registered values and the well known credential fields in s
+func String(s string) string {
+	lock.RLock()
+	s = maskFields(maskValues(s))
+	lock.RUnlock()
+
+	for _, pattern := range patterns {
+		s = pattern.ReplaceAllString(s, "${1}"+Mask+"${2}")
+	}
+	return s
+}
+
+// maskValues masks the registered values in s, the caller holds the read lock
+func maskValues(s string) string {
+	if len(byPrefix) == 0 {
+		return s
+	}
+	var masked strings.Builder
+	written := 0
+	for i := 0; i < len(s); {
+		if n := matchValue(s, i); n > 0 {
+			masked.WriteString(s[written:i])
+			masked.WriteString(Mask)
+			i += n
+			written = i
+			continue
+		}
+		i++
+	}
+	if written == 0 {
+		return s
+	}
+	masked.WriteString(s[written:])
+	return masked.String()
+}
+
+// matchValue returns the length of the longest registered value at position i of s, or 0 if there is none
+func matchValue(s string, i int) int {
+	if i+minSubstringLength <= len(s) {
+		for _, value := range byPrefix[s[i:i+minSubstringLength]] {
+			if strings.HasPrefix(s[i:], value) {
+				return len(value)
+			}
+		}
+	}
+	return 0
+}
+
+// maskFields masks the registered short values following their key in s, the caller holds the read lock
+func maskFields(s string) string {
+	for key, pattern := range fieldPatterns {
+		if !strings.Contains(s, key) {
+			continue
+		}
+		var masked strings.Builder
+		written := 0
+		for _, match := range pattern.FindAllStringSubmatchIndex(s, -1) {
+			start := match[2]
+			for n := minSubstringLength - 1; n > 0; n-- {
+				end := start + n
+				if end <= len(s) && shortFields[key][s[start:end]] && (end == len(s) || !isAlphanumeric(s[end])) {
+					masked.WriteString(s[written:start])
+					masked.WriteString(Mask)
+					written = end
+					break
+				}
+			}
+		}
+		if written > 0 {
+			masked.WriteString(s[written:])
+			s = masked.String()
+		}
+	}
+	return s
+}
+
+func isAlphanumeric(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// Error returns an error with the message of err redacted, or nil if err is nil
+func Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	return errors.New(String(err.Error()))
+}
+
+// Writer returns a writer redacting everything written to w. Output is redacted line by line, so a secret split
+// across writes is masked as well. An unterminated line is held until its end is written.
+func Writer(w io.Writer) io.Writer {
+	return &writer{out: w}
+}
+
+type writer struct {
+	lock    sync.Mutex
+	out     io.Writer
+	pending []byte
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.pending = append(w.pending, p...)
+	end := bytes.LastIndexByte(w.pending, '\n') + 1
+	if end == 0 && len(w.pending) >= maxPendingLength {
+		end = len(w.pending)
+	}
+	if end == 0 {
+		return len(p), nil
+	}
+	lines := string(w.pending[:end])
+	w.pending = append(w.pending[:0], w.pending[end:]...)
+	if _, err := io.WriteString(w.out, String(lines)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}